@@ -2,35 +2,562 @@ package core
 
 import (
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
+	"io/fs"
+	"net"
+	"net/url"
 	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
 )
 
-// Config structure for the database connection and server settings
+// ConfigFileEnv names the environment variable that picks the config file when -config is not given
+const ConfigFileEnv = "BOURDAIN_CONFIG"
+
+// Config structure for the database connection and server settings. It is assembled in layers: the
+// defaults, then the JSON config file, then environment variables, then command-line flags.
 type Config struct {
 	Database struct {
-		User     string `json:"user"`
-		Password string `json:"password"`
-		DbName   string `json:"dbname"`
-		Host     string `json:"host"`
-		Port     int    `json:"port"`
+		User string `json:"user"`
+		// Password is better kept out of the config file: set BOURDAIN_DATABASE_PASSWORD, or point
+		// PasswordFile at a file holding it (a Docker secret, say). A layer may give one or the other, and
+		// whichever comes from the later layer wins, so an explicit password overrides the file's.
+		Password     string `json:"password"`
+		PasswordFile string `json:"password_file"`
+		DbName       string `json:"dbname"`
+		Host         string `json:"host"`
+		Port         int    `json:"port"`
+		// SSLMode is disable, require, verify-ca or verify-full. SSLRootCert is the CA to verify the server
+		// against; SSLCert and SSLKey are a client certificate and its key.
+		SSLMode     string `json:"sslmode"`
+		SSLRootCert string `json:"sslrootcert"`
+		SSLCert     string `json:"sslcert"`
+		SSLKey      string `json:"sslkey"`
+		// MaxOpenConns caps the connection pool, zero meaning no limit
+		MaxOpenConns int `json:"max_open_conns"`
+		MaxIdleConns int `json:"max_idle_conns"`
+		// ConnMaxLifetime and ConnMaxIdleTime retire pooled connections, zero meaning never
+		ConnMaxLifetime Duration `json:"conn_max_lifetime"`
+		ConnMaxIdleTime Duration `json:"conn_max_idle_time"`
+		// ConnectTimeout is how long to keep retrying the database on startup, zero meaning try just once
+		ConnectTimeout Duration `json:"connect_timeout"`
 	} `json:"database"`
 	Server struct {
 		Port int `json:"port"`
+		// ListenAddress is the host:port to serve on; when empty the server listens on Port on every interface
+		ListenAddress string   `json:"listen_address"`
+		ReadTimeout   Duration `json:"read_timeout"`
+		WriteTimeout  Duration `json:"write_timeout"`
+		IdleTimeout   Duration `json:"idle_timeout"`
+		// LegacyGetEndpoints keeps the query-string GET forms of /restaurant/available and
+		// /restaurant/book registered alongside the JSON POST forms
+		LegacyGetEndpoints bool `json:"legacy_get_endpoints"`
 	} `json:"server"`
+	Log struct {
+		// Level is a logrus level name such as "debug" or "info"
+		Level string `json:"level"`
+	} `json:"log"`
+}
+
+// Duration is a time.Duration written in config files as a string such as "30s" or "2m"
+type Duration struct {
+	time.Duration
 }
 
-// LoadConfig loads the configuration from a JSON file
-func LoadConfig(filename string) (*Config, error) {
-	data, err := os.ReadFile(filename)
+// UnmarshalJSON reads a duration string
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("duration must be a string such as \"30s\"")
+	}
+	parsed, err := time.ParseDuration(s)
 	if err != nil {
-		return nil, fmt.Errorf("could not read config file: %v", err)
+		return err
+	}
+	d.Duration = parsed
+	return nil
+}
+
+// MarshalJSON writes the duration as a string
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+// ConfigError lists everything wrong with a configuration
+type ConfigError struct {
+	Problems []string
+}
+
+func (e *ConfigError) Error() string {
+	return "invalid configuration: " + strings.Join(e.Problems, "; ")
+}
+
+// DefaultConfig returns the configuration used for anything not set by the file, environment or flags
+func DefaultConfig() *Config {
+	config := &Config{}
+	config.Database.User = "bourdain"
+	config.Database.DbName = "bookingsdb"
+	config.Database.Host = "localhost"
+	config.Database.Port = 5432
+	config.Database.SSLMode = "disable"
+	config.Database.MaxOpenConns = 25
+	config.Database.MaxIdleConns = 10
+	config.Database.ConnMaxLifetime = Duration{30 * time.Minute}
+	config.Database.ConnMaxIdleTime = Duration{5 * time.Minute}
+	config.Database.ConnectTimeout = Duration{60 * time.Second}
+	config.Server.Port = 8080
+	config.Server.ReadTimeout = Duration{10 * time.Second}
+	config.Server.WriteTimeout = Duration{60 * time.Second}
+	config.Server.IdleTimeout = Duration{120 * time.Second}
+	config.Log.Level = "info"
+	return config
+}
+
+// ListenAddr returns the address the web service should listen on
+func (c *Config) ListenAddr() string {
+	if c.Server.ListenAddress != "" {
+		return c.Server.ListenAddress
 	}
+	return ":" + strconv.Itoa(c.Server.Port)
+}
 
-	var config Config
-	err = json.Unmarshal(data, &config)
+// LogLevel returns the configured logrus level, falling back to info if it does not parse
+func (c *Config) LogLevel() logrus.Level {
+	level, err := logrus.ParseLevel(c.Log.Level)
 	if err != nil {
-		return nil, fmt.Errorf("could not parse config file: %v", err)
+		return logrus.InfoLevel
+	}
+	return level
+}
+
+// Validate checks the whole configuration, reporting every problem rather than stopping at the first
+func (c *Config) Validate() error {
+	var problems []string
+	problem := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	if c.Database.User == "" {
+		problem("database.user is required")
+	}
+	if c.Database.DbName == "" {
+		problem("database.dbname is required")
+	}
+	if c.Database.Host == "" {
+		problem("database.host is required")
+	}
+	if c.Database.Port < 1 || c.Database.Port > 65535 {
+		problem("database.port must be between 1 and 65535, not %d", c.Database.Port)
+	}
+	switch c.Database.SSLMode {
+	case "disable", "require", "verify-ca", "verify-full":
+	default:
+		problem("database.sslmode must be disable, require, verify-ca or verify-full, not %q", c.Database.SSLMode)
+	}
+	if (c.Database.SSLCert == "") != (c.Database.SSLKey == "") {
+		problem("database.sslcert and database.sslkey must be given together")
+	}
+	for _, file := range []struct{ key, path string }{
+		{"database.password_file", c.Database.PasswordFile},
+		{"database.sslrootcert", c.Database.SSLRootCert},
+		{"database.sslcert", c.Database.SSLCert},
+		{"database.sslkey", c.Database.SSLKey},
+	} {
+		if file.path == "" {
+			continue
+		}
+		if _, err := os.Stat(file.path); err != nil {
+			problem("%s: %v", file.key, err)
+		}
+	}
+	if c.Database.MaxOpenConns < 0 {
+		problem("database.max_open_conns cannot be negative")
+	}
+	if c.Database.MaxIdleConns < 0 {
+		problem("database.max_idle_conns cannot be negative")
+	}
+	if c.Database.MaxOpenConns > 0 && c.Database.MaxIdleConns > c.Database.MaxOpenConns {
+		problem("database.max_idle_conns (%d) cannot exceed database.max_open_conns (%d)",
+			c.Database.MaxIdleConns, c.Database.MaxOpenConns)
+	}
+	if c.Database.ConnMaxLifetime.Duration < 0 {
+		problem("database.conn_max_lifetime cannot be negative")
+	}
+	if c.Database.ConnMaxIdleTime.Duration < 0 {
+		problem("database.conn_max_idle_time cannot be negative")
+	}
+	if c.Database.ConnectTimeout.Duration < 0 {
+		problem("database.connect_timeout cannot be negative")
+	}
+
+	if c.Server.ListenAddress != "" {
+		if _, _, err := net.SplitHostPort(c.Server.ListenAddress); err != nil {
+			problem("server.listen_address must be host:port: %v", err)
+		}
+	} else if c.Server.Port < 1 || c.Server.Port > 65535 {
+		problem("server.port must be between 1 and 65535, not %d", c.Server.Port)
+	}
+	if c.Server.ReadTimeout.Duration < 0 {
+		problem("server.read_timeout cannot be negative")
+	}
+	if c.Server.WriteTimeout.Duration < 0 {
+		problem("server.write_timeout cannot be negative")
+	}
+	if c.Server.IdleTimeout.Duration < 0 {
+		problem("server.idle_timeout cannot be negative")
+	}
+
+	if _, err := logrus.ParseLevel(c.Log.Level); err != nil {
+		problem("log.level %q is not a log level", c.Log.Level)
+	}
+
+	if len(problems) > 0 {
+		return &ConfigError{Problems: problems}
+	}
+	return nil
+}
+
+// setting is a configuration value that can also be given as an environment variable and a flag. The
+// key is its dotted path in the config file; the environment variable and flag names derive from it.
+type setting struct {
+	key    string
+	usage  string
+	isBool bool
+	set    func(c *Config, value string) error
+}
+
+// envName is the setting's environment variable, e.g. BOURDAIN_DATABASE_HOST for database.host
+func (s setting) envName() string {
+	return "BOURDAIN_" + strings.ToUpper(strings.ReplaceAll(s.key, ".", "_"))
+}
+
+// flagName is the setting's flag, e.g. -database-host for database.host
+func (s setting) flagName() string {
+	return strings.NewReplacer(".", "-", "_", "-").Replace(s.key)
+}
+
+func stringSetting(key, usage string, field func(c *Config) *string) setting {
+	return setting{key: key, usage: usage, set: func(c *Config, value string) error {
+		*field(c) = value
+		return nil
+	}}
+}
+
+func intSetting(key, usage string, field func(c *Config) *int) setting {
+	return setting{key: key, usage: usage, set: func(c *Config, value string) error {
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("%q is not a whole number", value)
+		}
+		*field(c) = n
+		return nil
+	}}
+}
+
+func boolSetting(key, usage string, field func(c *Config) *bool) setting {
+	return setting{key: key, usage: usage, isBool: true, set: func(c *Config, value string) error {
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("%q is not true or false", value)
+		}
+		*field(c) = b
+		return nil
+	}}
+}
+
+func durationSetting(key, usage string, field func(c *Config) *Duration) setting {
+	return setting{key: key, usage: usage, set: func(c *Config, value string) error {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("%q is not a duration such as \"30s\"", value)
+		}
+		field(c).Duration = d
+		return nil
+	}}
+}
+
+// settings lists everything that can be set from the environment or flags. database.url comes first so
+// that the more specific database settings override the parts of it they name.
+var settings = []setting{
+	{key: "database.url", usage: "postgres:// URL giving the database user, password, host, port and name",
+		set: (*Config).applyDatabaseURL},
+	stringSetting("database.host", "Database host", func(c *Config) *string { return &c.Database.Host }),
+	intSetting("database.port", "Database port", func(c *Config) *int { return &c.Database.Port }),
+	stringSetting("database.user", "Database user", func(c *Config) *string { return &c.Database.User }),
+	{key: "database.password", usage: "Database password", set: func(c *Config, value string) error {
+		c.setPassword(value)
+		return nil
+	}},
+	{key: "database.password_file", usage: "File holding the database password", set: func(c *Config, value string) error {
+		c.setPasswordFile(value)
+		return nil
+	}},
+	stringSetting("database.dbname", "Database name", func(c *Config) *string { return &c.Database.DbName }),
+	stringSetting("database.sslmode", "disable, require, verify-ca or verify-full",
+		func(c *Config) *string { return &c.Database.SSLMode }),
+	stringSetting("database.sslrootcert", "CA certificate to verify the database server against",
+		func(c *Config) *string { return &c.Database.SSLRootCert }),
+	stringSetting("database.sslcert", "Client certificate to present to the database",
+		func(c *Config) *string { return &c.Database.SSLCert }),
+	stringSetting("database.sslkey", "Key for the client certificate", func(c *Config) *string { return &c.Database.SSLKey }),
+	intSetting("database.max_open_conns", "Most database connections to open (0 for no limit)",
+		func(c *Config) *int { return &c.Database.MaxOpenConns }),
+	intSetting("database.max_idle_conns", "Most idle database connections to keep",
+		func(c *Config) *int { return &c.Database.MaxIdleConns }),
+	durationSetting("database.conn_max_lifetime", "Longest time to reuse a database connection (0 for no limit)",
+		func(c *Config) *Duration { return &c.Database.ConnMaxLifetime }),
+	durationSetting("database.conn_max_idle_time", "Longest time to keep an idle database connection (0 for no limit)",
+		func(c *Config) *Duration { return &c.Database.ConnMaxIdleTime }),
+	durationSetting("database.connect_timeout", "How long to keep retrying the database on startup",
+		func(c *Config) *Duration { return &c.Database.ConnectTimeout }),
+	intSetting("server.port", "Port to serve on when no listen address is set",
+		func(c *Config) *int { return &c.Server.Port }),
+	stringSetting("server.listen_address", "host:port to serve on",
+		func(c *Config) *string { return &c.Server.ListenAddress }),
+	durationSetting("server.read_timeout", "Longest time to read a request",
+		func(c *Config) *Duration { return &c.Server.ReadTimeout }),
+	durationSetting("server.write_timeout", "Longest time to write a response",
+		func(c *Config) *Duration { return &c.Server.WriteTimeout }),
+	durationSetting("server.idle_timeout", "Longest time to keep an idle connection open",
+		func(c *Config) *Duration { return &c.Server.IdleTimeout }),
+	boolSetting("server.legacy_get_endpoints", "Serve the query-string GET forms of the availability and booking endpoints",
+		func(c *Config) *bool { return &c.Server.LegacyGetEndpoints }),
+	stringSetting("log.level", "Log level (debug, info, warn, error)", func(c *Config) *string { return &c.Log.Level }),
+}
+
+// setPassword sets the database password, replacing any password file from an earlier layer
+func (c *Config) setPassword(password string) {
+	c.Database.Password = password
+	c.Database.PasswordFile = ""
+}
+
+// setPasswordFile sets the database password file, replacing any password from an earlier layer
+func (c *Config) setPasswordFile(path string) {
+	c.Database.PasswordFile = path
+	c.Database.Password = ""
+}
+
+// urlHasPassword reports whether raw is a URL with a password in it
+func urlHasPassword(raw string) bool {
+	u, err := url.Parse(raw)
+	if err != nil || u.User == nil {
+		return false
+	}
+	_, found := u.User.Password()
+	return found
+}
+
+// applyDatabaseURL sets whichever database connection settings the URL gives. The URL itself is kept
+// out of errors since it may hold a password.
+func (c *Config) applyDatabaseURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "postgres" && u.Scheme != "postgresql") {
+		return fmt.Errorf("not a postgres:// URL")
+	}
+	if u.User != nil {
+		c.Database.User = u.User.Username()
+		if password, found := u.User.Password(); found {
+			c.setPassword(password)
+		}
+	}
+	if host := u.Hostname(); host != "" {
+		c.Database.Host = host
+	}
+	if port := u.Port(); port != "" {
+		n, err := strconv.Atoi(port)
+		if err != nil {
+			return fmt.Errorf("invalid port in URL")
+		}
+		c.Database.Port = n
+	}
+	if dbName := strings.TrimPrefix(u.Path, "/"); dbName != "" {
+		c.Database.DbName = dbName
+	}
+	query := u.Query()
+	for param, field := range map[string]*string{
+		"sslmode":     &c.Database.SSLMode,
+		"sslrootcert": &c.Database.SSLRootCert,
+		"sslcert":     &c.Database.SSLCert,
+		"sslkey":      &c.Database.SSLKey,
+	} {
+		if query.Has(param) {
+			*field = query.Get(param)
+		}
+	}
+	return nil
+}
+
+// settingFlag holds a flag's raw value until the configuration is loaded
+type settingFlag struct {
+	value  string
+	isBool bool
+}
+
+func (f *settingFlag) String() string {
+	if f == nil {
+		return ""
+	}
+	return f.value
+}
+
+func (f *settingFlag) Set(value string) error {
+	f.value = value
+	return nil
+}
+
+func (f *settingFlag) IsBoolFlag() bool {
+	return f.isBool
+}
+
+// ConfigFlags are the configuration flags registered on a flag set
+type ConfigFlags struct {
+	flagSet *flag.FlagSet
+	file    *string
+	values  map[string]*settingFlag
+}
+
+// RegisterConfigFlags registers -config, naming the config file, and a flag for every setting. Call
+// Load once the flags have been parsed.
+func RegisterConfigFlags(flagSet *flag.FlagSet, defaultFile string) *ConfigFlags {
+	cf := &ConfigFlags{flagSet: flagSet, values: make(map[string]*settingFlag)}
+	cf.file = flagSet.String("config", defaultFile,
+		fmt.Sprintf("Path to the config file (or set %s); a missing default file is skipped", ConfigFileEnv))
+	for _, s := range settings {
+		value := &settingFlag{isBool: s.isBool}
+		cf.values[s.flagName()] = value
+		flagSet.Var(value, s.flagName(), fmt.Sprintf("%s (or set %s)", s.usage, s.envName()))
+	}
+	return cf
+}
+
+// Load builds the configuration from the defaults, config file, environment and flags, in that order of
+// precedence from lowest to highest, and validates it
+func (cf *ConfigFlags) Load() (*Config, error) {
+	setFlags := make(map[string]bool)
+	cf.flagSet.Visit(func(f *flag.Flag) {
+		setFlags[f.Name] = true
+	})
+
+	// a file that was asked for must exist, but the default may be absent outside Docker
+	path, required := *cf.file, setFlags["config"]
+	if envPath, found := os.LookupEnv(ConfigFileEnv); found && !required {
+		path, required = envPath, true
+	}
+
+	config := DefaultConfig()
+	if err := config.loadFile(path, required); err != nil {
+		return nil, err
+	}
+
+	// one layer can't give both a password, whether on its own or in a URL, and a password file
+	var problems []string
+	_, envPassword := os.LookupEnv("BOURDAIN_DATABASE_PASSWORD")
+	_, envPasswordFile := os.LookupEnv("BOURDAIN_DATABASE_PASSWORD_FILE")
+	if envPassword && envPasswordFile {
+		problems = append(problems, "BOURDAIN_DATABASE_PASSWORD and BOURDAIN_DATABASE_PASSWORD_FILE cannot both be set")
+	}
+	if envPasswordFile && (urlHasPassword(os.Getenv("DATABASE_URL")) || urlHasPassword(os.Getenv("BOURDAIN_DATABASE_URL"))) {
+		problems = append(problems, "BOURDAIN_DATABASE_PASSWORD_FILE cannot be set along with a database URL holding a password")
+	}
+	if setFlags["database-password"] && setFlags["database-password-file"] {
+		problems = append(problems, "-database-password and -database-password-file cannot both be given")
+	}
+	if setFlags["database-password-file"] && setFlags["database-url"] && urlHasPassword(cf.values["database-url"].value) {
+		problems = append(problems, "-database-password-file cannot be given along with a -database-url holding a password")
+	}
+
+	// DATABASE_URL is the conventional name, as docker-compose sets it
+	if raw, found := os.LookupEnv("DATABASE_URL"); found {
+		if err := config.applyDatabaseURL(raw); err != nil {
+			problems = append(problems, fmt.Sprintf("DATABASE_URL: %v", err))
+		}
+	}
+	for _, s := range settings {
+		if raw, found := os.LookupEnv(s.envName()); found {
+			if err := s.set(config, raw); err != nil {
+				problems = append(problems, fmt.Sprintf("%s: %v", s.envName(), err))
+			}
+		}
+	}
+	for _, s := range settings {
+		if setFlags[s.flagName()] {
+			if err := s.set(config, cf.values[s.flagName()].value); err != nil {
+				problems = append(problems, fmt.Sprintf("-%s: %v", s.flagName(), err))
+			}
+		}
+	}
+
+	if err := config.Validate(); err != nil {
+		var configErr *ConfigError
+		if errors.As(err, &configErr) {
+			problems = append(problems, configErr.Problems...)
+		}
+	}
+	if len(problems) > 0 {
+		return nil, &ConfigError{Problems: problems}
+	}
+
+	if err := config.readPasswordFile(); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// readPasswordFile sets the database password from PasswordFile, if there is one. A trailing newline, as
+// most editors and `echo` leave, is not part of the password.
+func (c *Config) readPasswordFile() error {
+	if c.Database.PasswordFile == "" {
+		return nil
+	}
+	data, err := os.ReadFile(c.Database.PasswordFile)
+	if err != nil {
+		return fmt.Errorf("could not read database password file: %v", err)
+	}
+	c.Database.Password = strings.TrimRight(string(data), "\r\n")
+	return nil
+}
+
+// loadFile reads the JSON config file over the current settings
+func (c *Config) loadFile(path string, required bool) error {
+	if path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) && !required {
+		logrus.Debugf("No config file at %s, using defaults and environment", path)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("could not read config file: %v", err)
+	}
+
+	// the file is a layer like any other, so its password or password file replaces the other's default
+	var passwords struct {
+		Database struct {
+			Password     *string `json:"password"`
+			PasswordFile *string `json:"password_file"`
+		} `json:"database"`
+	}
+	if err := json.Unmarshal(data, &passwords); err != nil {
+		return fmt.Errorf("could not parse config file: %v", err)
+	}
+	if passwords.Database.Password != nil && passwords.Database.PasswordFile != nil {
+		return fmt.Errorf("config file gives both database.password and database.password_file")
+	}
+
+	if err := json.Unmarshal(data, c); err != nil {
+		return fmt.Errorf("could not parse config file: %v", err)
+	}
+	if passwords.Database.Password != nil {
+		c.setPassword(*passwords.Database.Password)
+	}
+	if passwords.Database.PasswordFile != nil {
+		c.setPasswordFile(*passwords.Database.PasswordFile)
 	}
-	return &config, nil
+	return nil
 }
@@ -1,32 +1,61 @@
 package core
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
+	"github.com/janearc/bourdain/tooling/queries"
 	_ "github.com/lib/pq" // PostgreSQL driver
 	"github.com/sirupsen/logrus"
+	"io/fs"
+	"net"
 	"net/url"
 	"os"
+	"path"
 	"path/filepath"
+	"strconv"
+	"time"
 )
 
+// connectBackoff spaces out attempts to reach the database on startup
+var connectBackoff = Backoff{Initial: 250 * time.Millisecond, Max: 5 * time.Second}
+
+// ConnectDB opens the database pool described by config and waits, up to the connect timeout, for the
+// database to answer. Only connection failures are retried; a bad password or database name is not.
 func ConnectDB(config *Config) (*sql.DB, error) {
 	dsn := getDSN(config)
+	logrus.Infof("Connecting to database %s", dsn)
 
-	// Log the DSN for verification
-	logrus.Infof("Connecting to database with DSN: %s", dsn)
-
-	db, err := sql.Open("postgres", dsn)
+	db, err := sql.Open("postgres", dsn.secret())
 	if err != nil {
 		return nil, fmt.Errorf("error connecting to database: %v", err)
 	}
+	db.SetMaxOpenConns(config.Database.MaxOpenConns)
+	db.SetMaxIdleConns(config.Database.MaxIdleConns)
+	db.SetConnMaxLifetime(config.Database.ConnMaxLifetime.Duration)
+	db.SetConnMaxIdleTime(config.Database.ConnMaxIdleTime.Duration)
 
-	err = db.Ping()
-	if err != nil {
-		return nil, fmt.Errorf("error pinging database: %v", err)
-	}
+	timeout := config.Database.ConnectTimeout.Duration
+	deadline := time.Now().Add(timeout)
+	for attempt := 1; ; attempt++ {
+		ctx, cancel := context.Background(), context.CancelFunc(func() {})
+		if timeout > 0 {
+			ctx, cancel = context.WithDeadline(ctx, deadline)
+		}
+		err = db.PingContext(ctx)
+		cancel()
+		if err == nil {
+			return db, nil
+		}
 
-	return db, nil
+		delay := connectBackoff.Delay(attempt)
+		if timeout == 0 || !IsConnectionError(err) || time.Now().Add(delay).After(deadline) {
+			db.Close()
+			return nil, fmt.Errorf("error pinging database after %d attempts: %v", attempt, err)
+		}
+		logrus.Warnf("Database not ready (attempt %d), retrying in %v: %v", attempt, delay.Round(time.Millisecond), err)
+		time.Sleep(delay)
+	}
 }
 
 // GetCurrentDatabase retrieves the name of the currently connected database
@@ -39,30 +68,91 @@ func GetCurrentDatabase(db *sql.DB) (string, error) {
 	return dbName, nil
 }
 
-func getDSN(config *Config) string {
-	logrus.Info("getDSN is being called") // This will crash the app to ensure it runs this code
-	escapedUser := url.QueryEscape(config.Database.User)
-	escapedPassword := url.QueryEscape(config.Database.Password)
-	dsn := fmt.Sprintf("postgres://%s:%s@%s:%d/%s?sslmode=disable",
-		escapedUser,
-		escapedPassword,
-		config.Database.Host,
-		config.Database.Port,
-		config.Database.DbName)
-	logrus.Infof("Constructed DSN: %s", dsn)
-	return dsn
+// DSN is a postgres connection URL. It prints with the password masked, so it is safe to log.
+type DSN struct {
+	url *url.URL
+}
+
+// String returns the DSN with the password replaced by xxxxx
+func (d DSN) String() string {
+	return d.url.Redacted()
 }
 
-// LoadSQLFile loads a SQL file from a given directory
+// GoString keeps %#v from printing the password too
+func (d DSN) GoString() string {
+	return fmt.Sprintf("core.DSN(%q)", d.String())
+}
+
+// secret returns the DSN with the password, for handing to the driver and nothing else
+func (d DSN) secret() string {
+	return d.url.String()
+}
+
+// getDSN builds the connection URL from the database settings
+func getDSN(config *Config) DSN {
+	u := &url.URL{
+		Scheme: "postgres",
+		Host:   net.JoinHostPort(config.Database.Host, strconv.Itoa(config.Database.Port)),
+		Path:   "/" + config.Database.DbName,
+	}
+	if config.Database.Password != "" {
+		u.User = url.UserPassword(config.Database.User, config.Database.Password)
+	} else {
+		u.User = url.User(config.Database.User)
+	}
+
+	query := url.Values{}
+	query.Set("sslmode", config.Database.SSLMode)
+	for param, value := range map[string]string{
+		"sslrootcert": config.Database.SSLRootCert,
+		"sslcert":     config.Database.SSLCert,
+		"sslkey":      config.Database.SSLKey,
+	} {
+		if value != "" {
+			query.Set(param, value)
+		}
+	}
+	u.RawQuery = query.Encode()
+	return DSN{url: u}
+}
+
+// SQLDirEnv names the environment variable that, like SetSQLDir, points the SQL loader at a directory on disk
+const SQLDirEnv = "BOURDAIN_SQL_DIR"
+
+// sqlDir is the on-disk directory SQL is read from instead of the embedded copy, if set
+var sqlDir = os.Getenv(SQLDirEnv)
+
+// SetSQLDir makes the SQL loader read from dir rather than the SQL embedded in the binary, which is handy
+// when working on the queries; an empty dir goes back to the embedded SQL
+func SetSQLDir(dir string) {
+	sqlDir = dir
+}
+
+// SQLFS returns the SQL files: the override directory if one is set, or the copy embedded at build time
+func SQLFS() fs.FS {
+	if sqlDir != "" {
+		return os.DirFS(sqlDir)
+	}
+	return queries.Files
+}
+
+// LoadSQLFile loads a SQL file by name from SQLFS (e.g. "20_restaurant_book.sql"). An absolute path is
+// read from disk as is.
 func LoadSQLFile(filePath string) (string, error) {
-	sqlBytes, err := os.ReadFile(filepath.Clean(filePath)) // Use os.ReadFile instead of ioutil.ReadFile
+	var sqlBytes []byte
+	var err error
+	if filepath.IsAbs(filePath) {
+		sqlBytes, err = os.ReadFile(filepath.Clean(filePath))
+	} else {
+		sqlBytes, err = fs.ReadFile(SQLFS(), path.Clean(filepath.ToSlash(filePath)))
+	}
 	if err != nil {
 		return "", err
 	}
 	return string(sqlBytes), nil
 }
 
-// ExecSQLFromFile executes a SQL file from the given path (when expecting no rows)
+// ExecSQLFromFile executes a SQL file, loaded as by LoadSQLFile (when expecting no rows)
 func ExecSQLFromFile(db *sql.DB, queryPath string, args ...interface{}) (sql.Result, error) {
 	sqlQuery, err := LoadSQLFile(queryPath)
 	if err != nil {
@@ -0,0 +1,373 @@
+package core
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/sirupsen/logrus"
+)
+
+// migrationLockID is the advisory lock key held while migrating, so concurrent migrators take turns
+const migrationLockID = 7_302_417_055
+
+// migrationFilePattern matches NN_name.sql (or NN_name.up.sql) and NN_name.down.sql
+var migrationFilePattern = regexp.MustCompile(`^(\d+)_(.+?)(\.up|\.down)?\.sql$`)
+
+// Migration is one versioned schema change. Up is applied going forward and Down, if present, undoes
+// it. Checksum fingerprints Up so that editing an already applied migration is caught.
+type Migration struct {
+	Version  int
+	Name     string
+	Up       string
+	Down     string
+	Checksum string
+}
+
+// MigrationStatus is a migration alongside whether, when and in what form it was applied
+type MigrationStatus struct {
+	Migration
+	Applied   bool
+	AppliedAt time.Time
+	// Modified means the migration was applied with a different checksum than it has now
+	Modified bool
+}
+
+// appliedMigration is a row of the schema_migrations table
+type appliedMigration struct {
+	version   int
+	name      string
+	checksum  string
+	appliedAt time.Time
+}
+
+// LoadMigrations reads the migrations at the top of fsys (usually SQLFS), ordered by version. Every
+// version needs an up script; down scripts are optional, but a migration without one cannot be rolled back.
+func LoadMigrations(fsys fs.FS) ([]Migration, error) {
+	files, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, fmt.Errorf("error reading migrations directory: %v", err)
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, file := range files {
+		matches := migrationFilePattern.FindStringSubmatch(file.Name())
+		if file.IsDir() || matches == nil {
+			continue
+		}
+		version, err := strconv.Atoi(matches[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid migration version in %s: %v", file.Name(), err)
+		}
+
+		contents, err := fs.ReadFile(fsys, file.Name())
+		if err != nil {
+			return nil, fmt.Errorf("error reading migration %s: %v", file.Name(), err)
+		}
+
+		migration, found := byVersion[version]
+		if !found {
+			migration = &Migration{Version: version, Name: matches[2]}
+			byVersion[version] = migration
+		} else if migration.Name != matches[2] {
+			return nil, fmt.Errorf("migration version %d is used by both %s and %s", version, migration.Name, matches[2])
+		}
+
+		if matches[3] == ".down" {
+			migration.Down = string(contents)
+		} else {
+			if migration.Up != "" {
+				return nil, fmt.Errorf("migration version %d has more than one up script", version)
+			}
+			migration.Up = string(contents)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Up == "" {
+			return nil, fmt.Errorf("migration %d_%s has a down script but no up script", migration.Version, migration.Name)
+		}
+		sum := sha256.Sum256([]byte(migration.Up))
+		migration.Checksum = hex.EncodeToString(sum[:])
+		migrations = append(migrations, *migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
+
+// Migrator applies and rolls back migrations, recording them in the schema_migrations table
+type Migrator struct {
+	db         *sql.DB
+	migrations []Migration
+}
+
+// NewMigrator returns a Migrator for the given migrations, as loaded by LoadMigrations
+func NewMigrator(db *sql.DB, migrations []Migration) *Migrator {
+	return &Migrator{db: db, migrations: migrations}
+}
+
+// Up applies every pending migration in version order, returning how many were applied. It refuses to
+// run if an applied migration has since been edited or is missing.
+func (m *Migrator) Up(ctx context.Context) (int, error) {
+	count := 0
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		applied, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+		if err := m.verify(applied); err != nil {
+			return err
+		}
+
+		for _, migration := range m.migrations {
+			if _, done := applied[migration.Version]; done {
+				continue
+			}
+
+			logrus.Infof("Applying migration %d_%s", migration.Version, migration.Name)
+			err := inTransaction(ctx, conn, func(tx *sql.Tx) error {
+				if _, err := tx.ExecContext(ctx, migration.Up); err != nil {
+					return err
+				}
+				_, err := tx.ExecContext(ctx,
+					`INSERT INTO schema_migrations (version, name, checksum) VALUES ($1, $2, $3)`,
+					migration.Version, migration.Name, migration.Checksum)
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf("error applying migration %d_%s: %v", migration.Version, migration.Name, err)
+			}
+			count++
+		}
+		return nil
+	})
+	return count, err
+}
+
+// Down rolls back the most recently applied steps migrations, newest first, returning how many were
+// rolled back. Nothing is rolled back unless all of them have down scripts.
+func (m *Migrator) Down(ctx context.Context, steps int) (int, error) {
+	if steps < 1 {
+		return 0, fmt.Errorf("number of migrations to roll back must be positive")
+	}
+
+	count := 0
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		applied, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+		if err := m.verify(applied); err != nil {
+			return err
+		}
+
+		var rollback []Migration
+		for i := len(m.migrations) - 1; i >= 0 && len(rollback) < steps; i-- {
+			if _, done := applied[m.migrations[i].Version]; done {
+				rollback = append(rollback, m.migrations[i])
+			}
+		}
+		for _, migration := range rollback {
+			if migration.Down == "" {
+				return fmt.Errorf("migration %d_%s has no down script", migration.Version, migration.Name)
+			}
+		}
+
+		for _, migration := range rollback {
+			logrus.Infof("Rolling back migration %d_%s", migration.Version, migration.Name)
+			err := inTransaction(ctx, conn, func(tx *sql.Tx) error {
+				if _, err := tx.ExecContext(ctx, migration.Down); err != nil {
+					return err
+				}
+				_, err := tx.ExecContext(ctx, `DELETE FROM schema_migrations WHERE version = $1`, migration.Version)
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf("error rolling back migration %d_%s: %v", migration.Version, migration.Name, err)
+			}
+			count++
+		}
+		return nil
+	})
+	return count, err
+}
+
+// Baseline records every migration up to and including version as applied without running it, for
+// adopting a database whose schema was built before migrations were tracked. It returns how many were
+// recorded; migrations already recorded are left alone.
+func (m *Migrator) Baseline(ctx context.Context, version int) (int, error) {
+	if !m.known(version) {
+		return 0, fmt.Errorf("there is no migration %d to baseline at", version)
+	}
+
+	count := 0
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		applied, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+		if err := m.verify(applied); err != nil {
+			return err
+		}
+
+		return inTransaction(ctx, conn, func(tx *sql.Tx) error {
+			for _, migration := range m.migrations {
+				if _, done := applied[migration.Version]; done || migration.Version > version {
+					continue
+				}
+				logrus.Infof("Recording migration %d_%s as applied", migration.Version, migration.Name)
+				_, err := tx.ExecContext(ctx,
+					`INSERT INTO schema_migrations (version, name, checksum) VALUES ($1, $2, $3)`,
+					migration.Version, migration.Name, migration.Checksum)
+				if err != nil {
+					return fmt.Errorf("error recording migration %d_%s: %v", migration.Version, migration.Name, err)
+				}
+				count++
+			}
+			return nil
+		})
+	})
+	return count, err
+}
+
+// Status reports every known migration and whether it has been applied. It only reads, so it neither
+// waits for a running migration nor creates schema_migrations; without that table nothing is applied.
+func (m *Migrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+	applied, err := m.applied(ctx, m.db)
+	if err != nil {
+		var pqErr *pq.Error
+		if !errors.As(err, &pqErr) || pqErr.Code != "42P01" { // undefined_table
+			return nil, err
+		}
+		applied = map[int]appliedMigration{}
+	}
+
+	var statuses []MigrationStatus
+	for _, migration := range m.migrations {
+		status := MigrationStatus{Migration: migration}
+		if row, done := applied[migration.Version]; done {
+			status.Applied = true
+			status.AppliedAt = row.appliedAt
+			status.Modified = row.checksum != migration.Checksum
+		}
+		statuses = append(statuses, status)
+	}
+
+	for version, row := range applied {
+		if !m.known(version) {
+			logrus.Warnf("Migration %d_%s is applied but no longer exists", version, row.name)
+		}
+	}
+	return statuses, nil
+}
+
+// verify makes sure every applied migration still exists unchanged
+func (m *Migrator) verify(applied map[int]appliedMigration) error {
+	for _, migration := range m.migrations {
+		if row, done := applied[migration.Version]; done && row.checksum != migration.Checksum {
+			return fmt.Errorf("migration %d_%s has changed since it was applied; add a new migration instead",
+				migration.Version, migration.Name)
+		}
+	}
+	for version, row := range applied {
+		if !m.known(version) {
+			return fmt.Errorf("migration %d_%s is applied but no longer exists", version, row.name)
+		}
+	}
+	return nil
+}
+
+// known reports whether a migration with the given version was loaded
+func (m *Migrator) known(version int) bool {
+	for _, migration := range m.migrations {
+		if migration.Version == version {
+			return true
+		}
+	}
+	return false
+}
+
+// withLock runs fn on a single connection holding the migration advisory lock, creating the
+// schema_migrations table first if need be
+func (m *Migrator) withLock(ctx context.Context, fn func(conn *sql.Conn) error) error {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("error getting database connection: %v", err)
+	}
+	defer conn.Close()
+
+	logrus.Debug("Waiting for the migration lock")
+	if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, migrationLockID); err != nil {
+		return fmt.Errorf("error taking migration lock: %v", err)
+	}
+	defer func() {
+		if _, err := conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, migrationLockID); err != nil {
+			logrus.Errorf("Error releasing migration lock: %v", err)
+		}
+	}()
+
+	_, err = conn.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version integer NOT NULL,
+			name text NOT NULL,
+			checksum character(64) NOT NULL,
+			applied_at timestamp with time zone DEFAULT now() NOT NULL,
+			PRIMARY KEY (version)
+		)`)
+	if err != nil {
+		return fmt.Errorf("error creating schema_migrations table: %v", err)
+	}
+
+	return fn(conn)
+}
+
+// queryer is what applied needs to read with: a pooled *sql.DB or a single *sql.Conn
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// applied reads the schema_migrations table
+func (m *Migrator) applied(ctx context.Context, q queryer) (map[int]appliedMigration, error) {
+	rows, err := q.QueryContext(ctx, `SELECT version, name, checksum, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, fmt.Errorf("error reading schema_migrations: %w", err)
+	}
+	defer rows.Close()
+
+	applied := make(map[int]appliedMigration)
+	for rows.Next() {
+		var row appliedMigration
+		if err := rows.Scan(&row.version, &row.name, &row.checksum, &row.appliedAt); err != nil {
+			return nil, fmt.Errorf("error reading schema_migrations: %v", err)
+		}
+		applied[row.version] = row
+	}
+	return applied, rows.Err()
+}
+
+// inTransaction runs fn in a transaction on conn, committing only if it succeeds
+func inTransaction(ctx context.Context, conn *sql.Conn, fn func(tx *sql.Tx) error) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		if rollbackErr := tx.Rollback(); rollbackErr != nil {
+			logrus.Errorf("Error rolling back transaction: %v", rollbackErr)
+		}
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,70 @@
+package core
+
+import (
+	"database/sql/driver"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"syscall"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Backoff is an exponential backoff schedule: Initial before the first retry, doubling each time up to Max
+type Backoff struct {
+	Initial time.Duration
+	Max     time.Duration
+}
+
+// Delay returns how long to wait before the given retry (1 for the first). Up to half of it is random
+// jitter, so that clients which failed together don't all retry together.
+func (b Backoff) Delay(retry int) time.Duration {
+	delay := b.Initial
+	for i := 1; i < retry && delay < b.Max; i++ {
+		delay *= 2
+	}
+	if delay > b.Max {
+		delay = b.Max
+	}
+	if half := int64(delay / 2); half > 0 {
+		delay = time.Duration(half + rand.Int63n(half+1))
+	}
+	return delay
+}
+
+// IsSerializationFailure reports whether err is Postgres abandoning a transaction, rolled back in full,
+// because it clashed with a concurrent one: a serialization failure or a deadlock
+func IsSerializationFailure(err error) bool {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
+		return false
+	}
+	return pqErr.Code == "40001" || pqErr.Code == "40P01" // serialization_failure, deadlock_detected
+}
+
+// IsConnectionError reports whether err is the connection to the database failing rather than the
+// statement: the server being unreachable, still starting or shutting down, or the connection dropping.
+// A statement interrupted this way may or may not have taken effect.
+func IsConnectionError(err error) bool {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		switch pqErr.Code.Class() {
+		case "08": // connection_exception
+			return true
+		case "57": // operator_intervention: admin_shutdown, crash_shutdown, cannot_connect_now
+			return pqErr.Code != "57014" // query_canceled, which is a statement timeout
+		}
+		return false
+	}
+
+	var netErr net.Error
+	return errors.Is(err, driver.ErrBadConn) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.EPIPE) ||
+		errors.As(err, &netErr)
+}
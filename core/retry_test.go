@@ -0,0 +1,90 @@
+package core
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+func TestIsSerializationFailure(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{&pq.Error{Code: "40001"}, true},
+		{&pq.Error{Code: "40P01"}, true},
+		{fmt.Errorf("booking: %w", &pq.Error{Code: "40001"}), true},
+		{&pq.Error{Code: "23P01"}, false},
+		{&pq.Error{Code: "08006"}, false},
+		{errors.New("40001"), false},
+		{nil, false},
+	}
+	for _, tt := range tests {
+		if got := IsSerializationFailure(tt.err); got != tt.want {
+			t.Errorf("IsSerializationFailure(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestIsConnectionError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"connection failure", &pq.Error{Code: "08006"}, true},
+		{"cannot connect now", &pq.Error{Code: "57P03"}, true},
+		{"admin shutdown", &pq.Error{Code: "57P01"}, true},
+		{"statement timeout", &pq.Error{Code: "57014"}, false},
+		{"serialization failure", &pq.Error{Code: "40001"}, false},
+		{"unique violation", &pq.Error{Code: "23505"}, false},
+		{"bad connection", driver.ErrBadConn, true},
+		{"EOF", io.EOF, true},
+		{"unexpected EOF", fmt.Errorf("read: %w", io.ErrUnexpectedEOF), true},
+		{"connection reset", &net.OpError{Op: "read", Err: syscall.ECONNRESET}, true},
+		{"connection refused", syscall.ECONNREFUSED, true},
+		{"broken pipe", syscall.EPIPE, true},
+		{"other error", errors.New("no rows"), false},
+		{"nil", nil, false},
+	}
+	for _, tt := range tests {
+		if got := IsConnectionError(tt.err); got != tt.want {
+			t.Errorf("IsConnectionError(%s) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestBackoffDelay(t *testing.T) {
+	backoff := Backoff{Initial: 100 * time.Millisecond, Max: time.Second}
+	tests := []struct {
+		retry   int
+		ceiling time.Duration
+	}{
+		{1, 100 * time.Millisecond},
+		{2, 200 * time.Millisecond},
+		{3, 400 * time.Millisecond},
+		{4, 800 * time.Millisecond},
+		{5, time.Second},
+		{50, time.Second},
+	}
+	for _, tt := range tests {
+		// at least half the undelayed wait, the rest being jitter
+		for i := 0; i < 100; i++ {
+			delay := backoff.Delay(tt.retry)
+			if delay < tt.ceiling/2 || delay > tt.ceiling {
+				t.Fatalf("Delay(%d) = %v, want between %v and %v", tt.retry, delay, tt.ceiling/2, tt.ceiling)
+			}
+		}
+	}
+
+	if delay := (Backoff{}).Delay(1); delay != 0 {
+		t.Errorf("zero Backoff Delay(1) = %v, want 0", delay)
+	}
+}
@@ -14,7 +14,7 @@ func buildParty(w http.ResponseWriter, r *http.Request, db *sql.DB) {
 	// Convert the party size to an integer
 	partySize, err := strconv.Atoi(partySizeStr)
 	if err != nil || partySize <= 0 {
-		http.Error(w, "Invalid party size", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, errInvalidRequest, "Invalid party size", nil)
 		return
 	}
 
@@ -22,7 +22,7 @@ func buildParty(w http.ResponseWriter, r *http.Request, db *sql.DB) {
 	query := `SELECT diner_id::text FROM generate_party($1)`
 	rows, err := db.Query(query, partySize)
 	if err != nil {
-		http.Error(w, "Error querying database", http.StatusInternalServerError)
+		writeDBError(w, err, "Error querying database")
 		return
 	}
 	defer rows.Close()
@@ -32,7 +32,7 @@ func buildParty(w http.ResponseWriter, r *http.Request, db *sql.DB) {
 	for rows.Next() {
 		var dinerID string
 		if err := rows.Scan(&dinerID); err != nil {
-			http.Error(w, "Error scanning result", http.StatusInternalServerError)
+			writeError(w, http.StatusInternalServerError, errInternal, "Error scanning result", nil)
 			return
 		}
 		dinerUUIDs = append(dinerUUIDs, dinerID)
@@ -40,7 +40,7 @@ func buildParty(w http.ResponseWriter, r *http.Request, db *sql.DB) {
 
 	// Check for errors during rows iteration
 	if err := rows.Err(); err != nil {
-		http.Error(w, "Error processing data", http.StatusInternalServerError)
+		writeDBError(w, err, "Error processing data")
 		return
 	}
 
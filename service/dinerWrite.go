@@ -0,0 +1,99 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"github.com/google/uuid"
+	"net/http"
+	"strings"
+)
+
+// DinerRequest is the JSON body accepted by POST /diner and PATCH /diner/{id}. Restrictions must be
+// met by any restaurant the diner is booked into, while preferences only help rank restaurants.
+// Omitted fields are left unchanged by PATCH.
+type DinerRequest struct {
+	Name         *string   `json:"name"`
+	Restrictions *[]string `json:"restrictions"`
+	Preferences  *[]string `json:"preferences"`
+	Lat          *float64  `json:"lat"`
+	Lon          *float64  `json:"lon"`
+}
+
+// dinerCreate registers a new diner, rejecting endorsements that are not in the vocabulary
+func dinerCreate(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	var req DinerRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, errInvalidRequest, "Invalid request body", nil)
+		return
+	}
+
+	if req.Name == nil || strings.TrimSpace(*req.Name) == "" {
+		writeError(w, http.StatusBadRequest, errInvalidRequest, "Missing diner name", nil)
+		return
+	}
+	if (req.Lat == nil) != (req.Lon == nil) {
+		writeError(w, http.StatusBadRequest, errInvalidRequest, "Latitude and longitude must be given together", nil)
+		return
+	}
+	if req.Lat != nil && (*req.Lat < -90 || *req.Lat > 90 || *req.Lon < -180 || *req.Lon > 180) {
+		writeError(w, http.StatusBadRequest, errInvalidRequest, "Latitude or longitude out of range", nil)
+		return
+	}
+
+	query := `SELECT public.diner_create($1, $2::jsonb, $3::jsonb, $4::float8, $5::float8)::text`
+	var dinerUUID string
+	err := db.QueryRow(query, *req.Name, optionalTagsJSON(req.Restrictions), optionalTagsJSON(req.Preferences),
+		req.Lat, req.Lon).Scan(&dinerUUID)
+	if err != nil {
+		writeDBError(w, err, "Error creating diner")
+		return
+	}
+
+	response := map[string]string{
+		"status":   "success",
+		"diner_id": dinerUUID,
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(response)
+}
+
+// dinerUpdate changes a diner's name, restrictions or preferences
+func dinerUpdate(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	dinerUUID := r.PathValue("id")
+	if _, err := uuid.Parse(dinerUUID); err != nil {
+		writeError(w, http.StatusBadRequest, errInvalidID, "Invalid diner ID", nil)
+		return
+	}
+
+	var req DinerRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, errInvalidRequest, "Invalid request body", nil)
+		return
+	}
+
+	if req.Name != nil && strings.TrimSpace(*req.Name) == "" {
+		writeError(w, http.StatusBadRequest, errInvalidRequest, "Diner name cannot be empty", nil)
+		return
+	}
+	if req.Lat != nil || req.Lon != nil {
+		writeError(w, http.StatusBadRequest, errInvalidRequest, "A diner's location cannot be changed", nil)
+		return
+	}
+
+	query := `SELECT public.diner_update($1::uuid, $2, $3::jsonb, $4::jsonb)::text`
+	var updatedUUID string
+	err := db.QueryRow(query, dinerUUID, req.Name, optionalTagsJSON(req.Restrictions),
+		optionalTagsJSON(req.Preferences)).Scan(&updatedUUID)
+	if err != nil {
+		writeDBError(w, err, "Error updating diner")
+		return
+	}
+
+	response := map[string]string{
+		"status":   "success",
+		"diner_id": updatedUUID,
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// Endorsement is an entry in the endorsement vocabulary. A restaurant endorsed for Tag also satisfies
+// diners asking for anything in Implies.
+type Endorsement struct {
+	Tag         string   `json:"tag"`
+	Description string   `json:"description"`
+	Implies     []string `json:"implies"`
+}
+
+// endorsementList returns the endorsements that restaurants and diners may use
+func endorsementList(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	rows, err := db.Query(`SELECT tag, description, implies::text FROM public.endorsement_vocabulary()`)
+	if err != nil {
+		writeDBError(w, err, "Error querying database")
+		return
+	}
+	defer rows.Close()
+
+	endorsements := []Endorsement{}
+	for rows.Next() {
+		var endorsement Endorsement
+		var impliesJSON string
+		if err := rows.Scan(&endorsement.Tag, &endorsement.Description, &impliesJSON); err != nil {
+			writeError(w, http.StatusInternalServerError, errInternal, "Error scanning result", nil)
+			return
+		}
+		if err := json.Unmarshal([]byte(impliesJSON), &endorsement.Implies); err != nil {
+			writeDBError(w, fmt.Errorf("could not parse implications: %v", err), "Error processing data")
+			return
+		}
+		endorsements = append(endorsements, endorsement)
+	}
+
+	if err := rows.Err(); err != nil {
+		writeDBError(w, err, "Error processing data")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(endorsements)
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/lib/pq"
+	"github.com/sirupsen/logrus"
+)
+
+// Stable error codes returned in the "code" field of every error response. Clients match on
+// these rather than on the message, which is free to change.
+const (
+	errInvalidRequest       = "invalid_request"
+	errInvalidID            = "invalid_id"
+	errInvalidTime          = "invalid_time"
+	errInvalidTimeWindow    = "invalid_time_window"
+	errEmptyParty           = "empty_party"
+	errDuplicateDiner       = "duplicate_diner"
+	errNotFound             = "not_found"
+	errMethodNotAllowed     = "method_not_allowed"
+	errUnknownReference     = "unknown_reference"
+	errAlreadyExists        = "already_exists"
+	errReservationCancelled = "reservation_cancelled"
+	errInsufficientCapacity = "insufficient_capacity"
+	errNoTablesAvailable    = "no_tables_available"
+	errTableTaken           = "table_taken"
+	errDinerConflict        = "diner_conflict"
+	errEndorsementsNotMet   = "endorsements_not_met"
+	errRestaurantClosed     = "restaurant_closed"
+	errIdempotencyKeyReused = "idempotency_key_reused"
+	errInvalidDuration      = "invalid_duration"
+	errUnknownEndorsement   = "unknown_endorsement"
+	errInternal             = "internal_error"
+)
+
+// Custom SQLSTATEs raised by the stored procedures (class "BD") so that specific failures can be
+// told apart from one another and from genuine database errors
+const (
+	sqlStateDinerConflict        = "BD001"
+	sqlStateInsufficientCapacity = "BD002"
+	sqlStateNoTablesAvailable    = "BD003"
+	sqlStateEndorsementsNotMet   = "BD004"
+	sqlStateRestaurantClosed     = "BD005"
+	sqlStateInvalidTimeWindow    = "BD006"
+	sqlStateEmptyParty           = "BD007"
+	sqlStateIdempotencyKeyReused = "BD008"
+	sqlStateInvalidDuration      = "BD009"
+	sqlStateUnknownEndorsement   = "BD010"
+)
+
+// APIError is the JSON envelope for every error response
+type APIError struct {
+	Code    string      `json:"code"`
+	Message string      `json:"message"`
+	Details interface{} `json:"details,omitempty"`
+}
+
+// dbErrorMapping is how a database error is presented to the client
+type dbErrorMapping struct {
+	status int
+	code   string
+}
+
+// dbErrors maps SQLSTATEs to HTTP statuses and error codes; anything not listed is a 500
+var dbErrors = map[pq.ErrorCode]dbErrorMapping{
+	sqlStateDinerConflict:        {http.StatusConflict, errDinerConflict},
+	sqlStateInsufficientCapacity: {http.StatusUnprocessableEntity, errInsufficientCapacity},
+	sqlStateNoTablesAvailable:    {http.StatusConflict, errNoTablesAvailable},
+	sqlStateEndorsementsNotMet:   {http.StatusUnprocessableEntity, errEndorsementsNotMet},
+	sqlStateRestaurantClosed:     {http.StatusUnprocessableEntity, errRestaurantClosed},
+	sqlStateInvalidTimeWindow:    {http.StatusBadRequest, errInvalidTimeWindow},
+	sqlStateEmptyParty:           {http.StatusBadRequest, errEmptyParty},
+	sqlStateIdempotencyKeyReused: {http.StatusUnprocessableEntity, errIdempotencyKeyReused},
+	sqlStateInvalidDuration:      {http.StatusUnprocessableEntity, errInvalidDuration},
+	sqlStateUnknownEndorsement:   {http.StatusUnprocessableEntity, errUnknownEndorsement},
+	"P0002":                      {http.StatusNotFound, errNotFound},                    // no_data_found
+	"55000":                      {http.StatusConflict, errReservationCancelled},        // object_not_in_prerequisite_state
+	"23P01":                      {http.StatusConflict, errTableTaken},                  // exclusion_violation
+	"23503":                      {http.StatusUnprocessableEntity, errUnknownReference}, // foreign_key_violation
+	"23505":                      {http.StatusConflict, errAlreadyExists},               // unique_violation
+	"22023":                      {http.StatusBadRequest, errInvalidRequest},            // invalid_parameter_value
+	"22P02":                      {http.StatusBadRequest, errInvalidID},                 // invalid_text_representation
+}
+
+// writeError writes an error envelope with the given status
+func writeError(w http.ResponseWriter, status int, code, message string, details interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(APIError{Code: code, Message: message, Details: details})
+}
+
+// writeDBError maps a database error to the matching error envelope. Errors raised deliberately by the
+// stored procedures keep their message; anything unexpected is logged and reported with fallbackMessage.
+func writeDBError(w http.ResponseWriter, err error, fallbackMessage string) {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		if mapping, found := dbErrors[pqErr.Code]; found {
+			var details interface{}
+			switch pqErr.Code {
+			case sqlStateDinerConflict:
+				details = map[string]string{"conflicting_reservation_id": pqErr.Detail}
+			case sqlStateUnknownEndorsement:
+				details = map[string][]string{"unknown_endorsements": strings.Split(pqErr.Detail, ",")}
+			}
+			writeError(w, mapping.status, mapping.code, pqErr.Message, details)
+			return
+		}
+	}
+
+	logrus.Errorf("%s: %v", fallbackMessage, err)
+	writeError(w, http.StatusInternalServerError, errInternal, fallbackMessage, nil)
+}
+
+// hasSQLState reports whether err is a database error with the given SQLSTATE
+func hasSQLState(err error, code pq.ErrorCode) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == code
+}
+
+// routeErrorWriter stands in for the ResponseWriter when no route matches, replacing the mux's
+// plain-text 404 and 405 responses with error envelopes
+type routeErrorWriter struct {
+	http.ResponseWriter
+	replaced bool
+}
+
+func (w *routeErrorWriter) WriteHeader(status int) {
+	switch status {
+	case http.StatusNotFound:
+		w.replaced = true
+		writeError(w.ResponseWriter, status, errNotFound, "No such endpoint", nil)
+	case http.StatusMethodNotAllowed:
+		w.replaced = true
+		writeError(w.ResponseWriter, status, errMethodNotAllowed, "Method not allowed",
+			map[string]string{"allow": w.Header().Get("Allow")})
+	default:
+		w.ResponseWriter.WriteHeader(status)
+	}
+}
+
+func (w *routeErrorWriter) Write(b []byte) (int, error) {
+	if w.replaced {
+		return len(b), nil
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// withRouteErrors serves mux, reporting requests that match no route (404) or match a route only by
+// path (405, with the Allow header still set) through writeError like every other error
+func withRouteErrors(mux *http.ServeMux) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, pattern := mux.Handler(r); pattern == "" {
+			w = &routeErrorWriter{ResponseWriter: w}
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
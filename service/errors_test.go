@@ -0,0 +1,57 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/lib/pq"
+)
+
+func TestWriteDBError(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus int
+		wantCode   string
+	}{
+		{"mapped", &pq.Error{Code: sqlStateNoTablesAvailable}, http.StatusConflict, errNoTablesAvailable},
+		{"wrapped", fmt.Errorf("booking: %w", &pq.Error{Code: sqlStateEndorsementsNotMet}),
+			http.StatusUnprocessableEntity, errEndorsementsNotMet},
+		{"unique violation", &pq.Error{Code: "23505"}, http.StatusConflict, errAlreadyExists},
+		{"unmapped", &pq.Error{Code: "XX000"}, http.StatusInternalServerError, errInternal},
+		{"not a database error", errors.New("boom"), http.StatusInternalServerError, errInternal},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			writeDBError(recorder, tt.err, "Error booking")
+			if recorder.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", recorder.Code, tt.wantStatus)
+			}
+			var apiErr APIError
+			if err := json.NewDecoder(recorder.Body).Decode(&apiErr); err != nil {
+				t.Fatalf("error decoding response: %v", err)
+			}
+			if apiErr.Code != tt.wantCode {
+				t.Errorf("code = %q, want %q", apiErr.Code, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestHasSQLState(t *testing.T) {
+	err := fmt.Errorf("booking: %w", &pq.Error{Code: sqlStateDinerConflict})
+	if !hasSQLState(err, sqlStateDinerConflict) {
+		t.Errorf("hasSQLState() = false for a wrapped %s", sqlStateDinerConflict)
+	}
+	if hasSQLState(err, sqlStateNoTablesAvailable) {
+		t.Errorf("hasSQLState() = true for the wrong SQLSTATE")
+	}
+	if hasSQLState(errors.New("boom"), sqlStateDinerConflict) {
+		t.Errorf("hasSQLState() = true for an error that is not from the database")
+	}
+}
@@ -1,22 +1,24 @@
 package main
 
 import (
+	"flag"
 	"net/http"
-	"strconv"
+	_ "time/tzdata" // restaurants' time zones must resolve even where the host has no zoneinfo
 
 	"github.com/janearc/bourdain/core"
 	"github.com/sirupsen/logrus"
 )
 
 func main() {
-	// Use absolute path for config since it's inside Docker
-	config, err := core.LoadConfig("/config/config.json")
-
-	logrus.SetLevel(logrus.InfoLevel)
+	// The default file is where the Docker image keeps it; environment variables and flags override it
+	configFlags := core.RegisterConfigFlags(flag.CommandLine, "/config/config.json")
+	flag.Parse()
 
+	config, err := configFlags.Load()
 	if err != nil {
 		logrus.Fatalf("Could not load config: %v", err)
 	}
+	logrus.SetLevel(config.LogLevel())
 
 	// Connect to the database
 	db, err := core.ConnectDB(config)
@@ -30,14 +32,67 @@ func main() {
 	}()
 
 	// Define HTTP handlers with closure to pass `db` into handlers
-	http.HandleFunc("/restaurant/available", func(w http.ResponseWriter, r *http.Request) {
+	http.HandleFunc("POST /restaurant/available", func(w http.ResponseWriter, r *http.Request) {
 		restaurantAvailability(w, r, db)
 	})
 
-	http.HandleFunc("/restaurant/book", func(w http.ResponseWriter, r *http.Request) {
+	http.HandleFunc("POST /restaurant/alternatives", func(w http.ResponseWriter, r *http.Request) {
+		restaurantAlternatives(w, r, db)
+	})
+
+	http.HandleFunc("POST /restaurant/book", func(w http.ResponseWriter, r *http.Request) {
 		restaurantBook(w, r, db)
 	})
 
+	// the original query-string GET forms, kept for existing scripts until they move to POST
+	if config.Server.LegacyGetEndpoints {
+		logrus.Info("Legacy GET endpoints for /restaurant/available and /restaurant/book are enabled")
+
+		http.HandleFunc("GET /restaurant/available", func(w http.ResponseWriter, r *http.Request) {
+			restaurantAvailabilityQuery(w, r, db)
+		})
+
+		http.HandleFunc("GET /restaurant/book", func(w http.ResponseWriter, r *http.Request) {
+			restaurantBookQuery(w, r, db)
+		})
+	}
+
+	http.HandleFunc("DELETE /reservation/{id}", func(w http.ResponseWriter, r *http.Request) {
+		reservationCancel(w, r, db)
+	})
+
+	http.HandleFunc("GET /reservation/{id}", func(w http.ResponseWriter, r *http.Request) {
+		reservationGet(w, r, db)
+	})
+
+	http.HandleFunc("PATCH /reservation/{id}", func(w http.ResponseWriter, r *http.Request) {
+		reservationModify(w, r, db)
+	})
+
+	http.HandleFunc("GET /diner/{id}/reservations", func(w http.ResponseWriter, r *http.Request) {
+		dinerReservations(w, r, db)
+	})
+
+	http.HandleFunc("POST /diner", func(w http.ResponseWriter, r *http.Request) {
+		dinerCreate(w, r, db)
+	})
+
+	http.HandleFunc("PATCH /diner/{id}", func(w http.ResponseWriter, r *http.Request) {
+		dinerUpdate(w, r, db)
+	})
+
+	http.HandleFunc("POST /restaurant/{id}/next_available", func(w http.ResponseWriter, r *http.Request) {
+		restaurantNextAvailable(w, r, db)
+	})
+
+	http.HandleFunc("PATCH /restaurant/{id}", func(w http.ResponseWriter, r *http.Request) {
+		restaurantUpdate(w, r, db)
+	})
+
+	http.HandleFunc("GET /endorsements", func(w http.ResponseWriter, r *http.Request) {
+		endorsementList(w, r, db)
+	})
+
 	// these are private functions which are required for keeping "solution"
 	// code out of golang. essentially, the tool that validates the http endpoints
 	// feels to me to be "cheating" to have database calls in it. so while it kind
@@ -49,8 +104,14 @@ func main() {
 		buildParty(w, r, db)
 	})
 
-	// Start the web server using the port from config.json
-	port := strconv.Itoa(config.Server.Port)
-	logrus.Infof("Server starting on port %s", port)
-	logrus.Fatal(http.ListenAndServe(":"+port, nil))
+	// Start the web server on the configured address
+	server := &http.Server{
+		Addr:         config.ListenAddr(),
+		Handler:      withRouteErrors(http.DefaultServeMux),
+		ReadTimeout:  config.Server.ReadTimeout.Duration,
+		WriteTimeout: config.Server.WriteTimeout.Duration,
+		IdleTimeout:  config.Server.IdleTimeout.Duration,
+	}
+	logrus.Infof("Server starting on %s", server.Addr)
+	logrus.Fatal(server.ListenAndServe())
 }
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Party describes who a booking or availability search is for: any registered diners, plus
+// anonymous guests making up the rest of PartySize. A zero PartySize means the party is exactly
+// the registered diners. Guest restrictions must be met by a restaurant, while guest preferences
+// only help rank restaurants.
+type Party struct {
+	DinerIDs          []string `json:"diner_ids"`
+	PartySize         int      `json:"party_size"`
+	GuestRestrictions []string `json:"guest_restrictions"`
+	GuestPreferences  []string `json:"guest_preferences"`
+}
+
+// partyFromQuery reads the legacy query-string form of a party
+func partyFromQuery(r *http.Request) (Party, *APIError) {
+	var party Party
+	if dinerUUIDStr := r.URL.Query().Get("dinerUUIDs"); dinerUUIDStr != "" {
+		party.DinerIDs = strings.Split(dinerUUIDStr, ",")
+	}
+	if partySizeStr := r.URL.Query().Get("partySize"); partySizeStr != "" {
+		partySize, err := strconv.Atoi(partySizeStr)
+		if err != nil {
+			return party, &APIError{Code: errInvalidRequest, Message: "Invalid party size"}
+		}
+		party.PartySize = partySize
+	}
+	if guestRestrictionsStr := r.URL.Query().Get("guestRestrictions"); guestRestrictionsStr != "" {
+		party.GuestRestrictions = strings.Split(guestRestrictionsStr, ",")
+	}
+	if guestPrefsStr := r.URL.Query().Get("guestPreferences"); guestPrefsStr != "" {
+		party.GuestPreferences = strings.Split(guestPrefsStr, ",")
+	}
+	return party, nil
+}
+
+// validate checks the party makes sense before it is sent to the database
+func (p Party) validate() *APIError {
+	seen := make(map[string]bool, len(p.DinerIDs))
+	for _, id := range p.DinerIDs {
+		if id == "" {
+			return &APIError{Code: errInvalidID, Message: "Empty diner ID"}
+		}
+		// The database reads UUIDs regardless of case, so those are the same diner too
+		normalized := strings.ToLower(strings.TrimSpace(id))
+		if seen[normalized] {
+			return &APIError{Code: errDuplicateDiner, Message: fmt.Sprintf("Diner %s is listed more than once", id)}
+		}
+		seen[normalized] = true
+	}
+	switch {
+	case p.PartySize < 0:
+		return &APIError{Code: errInvalidRequest, Message: "Invalid party size"}
+	case len(p.DinerIDs) == 0 && p.PartySize == 0:
+		return &APIError{Code: errEmptyParty, Message: "No diners or party size provided"}
+	case p.PartySize > 0 && p.PartySize < len(p.DinerIDs):
+		return &APIError{Code: errInvalidRequest, Message: "Party size is smaller than the number of diners listed"}
+	case p.PartySize == 0 && (len(p.GuestPreferences) > 0 || len(p.GuestRestrictions) > 0):
+		return &APIError{Code: errInvalidRequest, Message: "Guest preferences or restrictions given without a party size"}
+	}
+	return nil
+}
+
+// requestedSize is the party size to hand to the stored procedures, nil meaning "just the diners"
+func (p Party) requestedSize() *int {
+	if p.PartySize == 0 {
+		return nil
+	}
+	return &p.PartySize
+}
+
+// guestPreferencesJSON encodes the guests' preferences as the JSON array the stored procedures expect
+func (p Party) guestPreferencesJSON() string {
+	return tagsJSON(p.GuestPreferences)
+}
+
+// guestRestrictionsJSON encodes the guests' dietary restrictions as the JSON array the stored procedures expect
+func (p Party) guestRestrictionsJSON() string {
+	return tagsJSON(p.GuestRestrictions)
+}
+
+// optionalTagsJSON encodes a list of endorsement tags that may be omitted, returning nil when it was
+func optionalTagsJSON(tags *[]string) *string {
+	if tags == nil {
+		return nil
+	}
+	encoded := tagsJSON(*tags)
+	return &encoded
+}
+
+// tagsJSON encodes a list of endorsement tags as a JSON array, never null
+func tagsJSON(tags []string) string {
+	if len(tags) == 0 {
+		return "[]"
+	}
+	encoded, _ := json.Marshal(tags)
+	return string(encoded)
+}
@@ -0,0 +1,42 @@
+package main
+
+import "testing"
+
+func TestPartyValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		party    Party
+		wantCode string
+	}{
+		{name: "registered diners", party: Party{DinerIDs: []string{"a", "b"}}},
+		{name: "diners and guests", party: Party{DinerIDs: []string{"a"}, PartySize: 3}},
+		{name: "guests only", party: Party{PartySize: 4}},
+		{name: "guests with restrictions and preferences",
+			party: Party{PartySize: 2, GuestRestrictions: []string{"kosher"}, GuestPreferences: []string{"organic"}}},
+		{name: "empty diner ID", party: Party{DinerIDs: []string{"a", ""}}, wantCode: errInvalidID},
+		{name: "duplicate diner", party: Party{DinerIDs: []string{"a", "b", "a"}}, wantCode: errDuplicateDiner},
+		{name: "duplicate diner in another case",
+			party:    Party{DinerIDs: []string{"6f1c0c7e-0000-4000-8000-000000000001", "6F1C0C7E-0000-4000-8000-000000000001"}},
+			wantCode: errDuplicateDiner},
+		{name: "negative size", party: Party{PartySize: -1}, wantCode: errInvalidRequest},
+		{name: "nobody", party: Party{}, wantCode: errEmptyParty},
+		{name: "size below diners", party: Party{DinerIDs: []string{"a", "b", "c"}, PartySize: 2},
+			wantCode: errInvalidRequest},
+		{name: "guest restrictions without a size",
+			party: Party{DinerIDs: []string{"a"}, GuestRestrictions: []string{"vegan"}}, wantCode: errInvalidRequest},
+		{name: "guest preferences without a size",
+			party: Party{DinerIDs: []string{"a"}, GuestPreferences: []string{"organic"}}, wantCode: errInvalidRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			apiErr := tt.party.validate()
+			switch {
+			case tt.wantCode == "" && apiErr != nil:
+				t.Errorf("validate() = %+v, want nil", apiErr)
+			case tt.wantCode != "" && (apiErr == nil || apiErr.Code != tt.wantCode):
+				t.Errorf("validate() = %+v, want code %q", apiErr, tt.wantCode)
+			}
+		})
+	}
+}
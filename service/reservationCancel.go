@@ -0,0 +1,48 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"github.com/google/uuid"
+	"net/http"
+	"time"
+)
+
+// reservationCancel cancels a reservation, releasing its tables and diners
+func reservationCancel(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	reservationUUID := r.PathValue("id")
+	if _, err := uuid.Parse(reservationUUID); err != nil {
+		writeError(w, http.StatusBadRequest, errInvalidID, "Invalid reservation ID", nil)
+		return
+	}
+
+	// Record who asked for the cancellation, if they told us
+	cancelledBy := r.URL.Query().Get("cancelledBy")
+	if cancelledBy == "" {
+		cancelledBy = "api"
+	}
+
+	// Call the stored procedure
+	query := `SELECT reservation_id::text, freed_tables, freed_seats, cancelled_at FROM public.reservation_cancel($1::uuid, $2)`
+
+	var reservationID string
+	var freedTables, freedSeats int
+	var cancelledAt time.Time
+	err := db.QueryRow(query, reservationUUID, cancelledBy).Scan(&reservationID, &freedTables, &freedSeats, &cancelledAt)
+	if err != nil {
+		writeDBError(w, err, "Error cancelling reservation")
+		return
+	}
+
+	// Respond with what was released
+	response := map[string]interface{}{
+		"status":         "cancelled",
+		"reservation_id": reservationID,
+		"cancelled_by":   cancelledBy,
+		"cancelled_at":   formatUTC(cancelledAt),
+		"freed_tables":   freedTables,
+		"freed_seats":    freedSeats,
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
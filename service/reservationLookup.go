@@ -0,0 +1,151 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"github.com/google/uuid"
+	"net/http"
+	"time"
+)
+
+// ReservationDiner is a party member on a reservation
+type ReservationDiner struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// ReservationTable is a table assigned to a reservation
+type ReservationTable struct {
+	ID        string `json:"id"`
+	TableSize int    `json:"table_size"`
+}
+
+// Reservation is the JSON representation of a reservation returned by the lookup endpoints
+type Reservation struct {
+	ID                string             `json:"reservation_id"`
+	RestaurantID      string             `json:"restaurant_id"`
+	RestaurantName    string             `json:"restaurant_name"`
+	TimeZone          string             `json:"time_zone"`
+	StartTime         string             `json:"start_time"`
+	EndTime           string             `json:"end_time"`
+	StartTimeLocal    string             `json:"start_time_local"`
+	EndTimeLocal      string             `json:"end_time_local"`
+	NumDiners         int                `json:"num_diners"`
+	NumGuests         int                `json:"num_guests"`
+	GuestRestrictions []string           `json:"guest_restrictions"`
+	GuestPrefs        []string           `json:"guest_preferences"`
+	Status            string             `json:"status"`
+	Notes             string             `json:"notes,omitempty"`
+	Diners            []ReservationDiner `json:"diners"`
+	Tables            []ReservationTable `json:"tables"`
+}
+
+// reservationSummaryColumns are the columns selected from the reservation_summaries set-returning functions
+const reservationSummaryColumns = `reservation_id::text, restaurant_id::text, restaurant_name, restaurant_time_zone,
+		start_time, end_time,
+		num_diners, num_guests, guest_restrictions::text, guest_preferences::text, status, COALESCE(notes, ''), diners::text, tables::text`
+
+// scanReservation reads one reservation_summaries row into a Reservation
+func scanReservation(rows *sql.Rows) (Reservation, error) {
+	var res Reservation
+	var startTime, endTime time.Time
+	var guestRestrictionsJSON, guestPrefsJSON, dinersJSON, tablesJSON string
+	err := rows.Scan(&res.ID, &res.RestaurantID, &res.RestaurantName, &res.TimeZone, &startTime, &endTime,
+		&res.NumDiners, &res.NumGuests, &guestRestrictionsJSON, &guestPrefsJSON, &res.Status, &res.Notes, &dinersJSON, &tablesJSON)
+	if err != nil {
+		return res, err
+	}
+
+	res.StartTime = formatUTC(startTime)
+	res.EndTime = formatUTC(endTime)
+	res.StartTimeLocal = formatLocal(startTime, res.TimeZone)
+	res.EndTimeLocal = formatLocal(endTime, res.TimeZone)
+
+	if err := json.Unmarshal([]byte(guestRestrictionsJSON), &res.GuestRestrictions); err != nil {
+		return res, fmt.Errorf("could not parse guest restrictions: %v", err)
+	}
+	if err := json.Unmarshal([]byte(guestPrefsJSON), &res.GuestPrefs); err != nil {
+		return res, fmt.Errorf("could not parse guest preferences: %v", err)
+	}
+	if err := json.Unmarshal([]byte(dinersJSON), &res.Diners); err != nil {
+		return res, fmt.Errorf("could not parse diners: %v", err)
+	}
+	if err := json.Unmarshal([]byte(tablesJSON), &res.Tables); err != nil {
+		return res, fmt.Errorf("could not parse tables: %v", err)
+	}
+	return res, nil
+}
+
+// reservationGet returns a single reservation by ID
+func reservationGet(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	reservationUUID := r.PathValue("id")
+	if _, err := uuid.Parse(reservationUUID); err != nil {
+		writeError(w, http.StatusBadRequest, errInvalidID, "Invalid reservation ID", nil)
+		return
+	}
+
+	query := `SELECT ` + reservationSummaryColumns + ` FROM public.reservation_details($1::uuid)`
+	rows, err := db.Query(query, reservationUUID)
+	if err != nil {
+		writeDBError(w, err, "Error querying database")
+		return
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			writeError(w, http.StatusInternalServerError, errInternal, "Error processing data", nil)
+			return
+		}
+		writeError(w, http.StatusNotFound, errNotFound, "Reservation not found", nil)
+		return
+	}
+
+	reservation, err := scanReservation(rows)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, errInternal, "Error scanning result", nil)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(reservation)
+}
+
+// dinerReservations returns the reservations a diner is part of, optionally only upcoming ones
+func dinerReservations(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	dinerUUID := r.PathValue("id")
+	if _, err := uuid.Parse(dinerUUID); err != nil {
+		writeError(w, http.StatusBadRequest, errInvalidID, "Invalid diner ID", nil)
+		return
+	}
+
+	upcomingOnly := r.URL.Query().Get("upcoming") == "true"
+
+	query := `SELECT ` + reservationSummaryColumns + ` FROM public.diner_reservations($1::uuid, $2)`
+	rows, err := db.Query(query, dinerUUID, upcomingOnly)
+	if err != nil {
+		writeDBError(w, err, "Error querying database")
+		return
+	}
+	defer rows.Close()
+
+	reservations := []Reservation{}
+	for rows.Next() {
+		reservation, err := scanReservation(rows)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, errInternal, "Error scanning result", nil)
+			return
+		}
+		reservations = append(reservations, reservation)
+	}
+
+	// Check for errors during rows iteration; the diner check may surface here rather than from Query
+	if err := rows.Err(); err != nil {
+		writeDBError(w, err, "Error processing data")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(reservations)
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"net/http"
+	"time"
+)
+
+// ReservationChange is the JSON body accepted by PATCH /reservation/{id}; omitted fields are left unchanged
+type ReservationChange struct {
+	RestaurantID *string  `json:"restaurant_id"`
+	StartTime    *string  `json:"start_time"`
+	EndTime      *string  `json:"end_time"`
+	AddDiners    []string `json:"add_diners"`
+	RemoveDiners []string `json:"remove_diners"`
+}
+
+// parseOptionalTime parses an optional RFC3339 time, returning nil when it was not supplied
+func parseOptionalTime(value *string) (*time.Time, error) {
+	if value == nil {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, *value)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// reservationModify changes the time, party or restaurant of a reservation without giving up the original slot on failure
+func reservationModify(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	reservationUUID := r.PathValue("id")
+	if _, err := uuid.Parse(reservationUUID); err != nil {
+		writeError(w, http.StatusBadRequest, errInvalidID, "Invalid reservation ID", nil)
+		return
+	}
+
+	var change ReservationChange
+	if err := json.NewDecoder(r.Body).Decode(&change); err != nil {
+		writeError(w, http.StatusBadRequest, errInvalidRequest, "Invalid request body", nil)
+		return
+	}
+
+	startTime, err := parseOptionalTime(change.StartTime)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, errInvalidTime, "Invalid start time format", nil)
+		return
+	}
+	endTime, err := parseOptionalTime(change.EndTime)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, errInvalidTime, "Invalid end time format", nil)
+		return
+	}
+
+	for _, id := range append(append([]string{}, change.AddDiners...), change.RemoveDiners...) {
+		if _, err := uuid.Parse(id); err != nil {
+			writeError(w, http.StatusBadRequest, errInvalidID, "Invalid diner ID", nil)
+			return
+		}
+	}
+	if change.RestaurantID != nil {
+		if _, err := uuid.Parse(*change.RestaurantID); err != nil {
+			writeError(w, http.StatusBadRequest, errInvalidID, "Invalid restaurant ID", nil)
+			return
+		}
+	}
+
+	// Call the stored procedure; it re-runs the availability checks and is all-or-nothing
+	query := `SELECT public.reservation_modify($1::uuid, $2::uuid, $3::timestamptz, $4::timestamptz, $5::uuid[], $6::uuid[])`
+
+	// Adding and removing diners can't safely be repeated, so a dropped connection is not retried
+	var modifiedUUID string
+	err = retryBooking(false, func() error {
+		return db.QueryRow(query, reservationUUID, change.RestaurantID, startTime, endTime,
+			pq.Array(change.AddDiners), pq.Array(change.RemoveDiners)).Scan(&modifiedUUID)
+	})
+	if err != nil {
+		writeDBError(w, err, "Error modifying reservation")
+		return
+	}
+
+	// Respond with the reservation as it now stands
+	rows, err := db.Query(`SELECT `+reservationSummaryColumns+` FROM public.reservation_details($1::uuid)`, modifiedUUID)
+	if err != nil {
+		writeDBError(w, err, "Error querying database")
+		return
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		writeError(w, http.StatusInternalServerError, errInternal, "Error processing data", nil)
+		return
+	}
+
+	reservation, err := scanReservation(rows)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, errInternal, "Error scanning result", nil)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(reservation)
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"github.com/lib/pq"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Defaults and limits for the alternative times search. The window and step may each go further, but
+// together may not ask for more than maxAlternativesStartTimes start times (±12 hours at 15 minutes,
+// or ±4 hours at 5 minutes), keeping the number of candidate windows checked bounded.
+const (
+	defaultAlternativesWindowHours   = 2
+	defaultAlternativesStepMinutes   = 15
+	defaultAlternativesPerRestaurant = 2
+	maxAlternativesWindowHours       = 12
+	minAlternativesStepMinutes       = 5
+	maxAlternativesStartTimes        = 96
+	maxAlternativesPerRestaurant     = 10
+)
+
+// AlternativesRequest is the JSON body accepted by POST /restaurant/alternatives: an availability search
+// plus how far either side of the requested start time to look, and in what increments
+type AlternativesRequest struct {
+	AvailabilityRequest
+	WindowHours        int `json:"window_hours"`
+	IncrementMinutes   int `json:"increment_minutes"`
+	SlotsPerRestaurant int `json:"slots_per_restaurant"`
+}
+
+// validateSearchSteps fills in the defaults for the alternative times search and checks its limits
+func (req *AlternativesRequest) validateSearchSteps() *APIError {
+	if req.WindowHours == 0 {
+		req.WindowHours = defaultAlternativesWindowHours
+	}
+	if req.IncrementMinutes == 0 {
+		req.IncrementMinutes = defaultAlternativesStepMinutes
+	}
+	if req.SlotsPerRestaurant == 0 {
+		req.SlotsPerRestaurant = defaultAlternativesPerRestaurant
+	}
+
+	switch {
+	case req.WindowHours < 0 || req.WindowHours > maxAlternativesWindowHours:
+		return &APIError{Code: errInvalidRequest,
+			Message: fmt.Sprintf("Window must be between 1 and %d hours", maxAlternativesWindowHours)}
+	case req.IncrementMinutes < minAlternativesStepMinutes || req.IncrementMinutes > req.WindowHours*60:
+		return &APIError{Code: errInvalidRequest,
+			Message: fmt.Sprintf("Increment must be at least %d minutes and no longer than the window", minAlternativesStepMinutes)}
+	case 2*req.WindowHours*60/req.IncrementMinutes > maxAlternativesStartTimes:
+		return &APIError{Code: errInvalidRequest,
+			Message: fmt.Sprintf("Window and increment would try more than %d start times; widen the increment or narrow the window",
+				maxAlternativesStartTimes)}
+	case req.SlotsPerRestaurant < 0 || req.SlotsPerRestaurant > maxAlternativesPerRestaurant:
+		return &APIError{Code: errInvalidRequest,
+			Message: fmt.Sprintf("Slots per restaurant must be between 1 and %d", maxAlternativesPerRestaurant)}
+	}
+	return nil
+}
+
+// restaurantAlternatives suggests start times near the requested one at restaurants that could seat the party then
+func restaurantAlternatives(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	var req AlternativesRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, errInvalidRequest, "Invalid request body", nil)
+		return
+	}
+
+	startTime, endTime, apiErr := req.resolve()
+	if apiErr != nil {
+		writeError(w, http.StatusBadRequest, apiErr.Code, apiErr.Message, nil)
+		return
+	}
+	if apiErr := req.validateSearchSteps(); apiErr != nil {
+		writeError(w, http.StatusBadRequest, apiErr.Code, apiErr.Message, nil)
+		return
+	}
+
+	query := `
+		SELECT a.restaurant_id, a.restaurant_name, a.start_time, a.end_time, a.offset_minutes,
+		       a.matched_endorsements::text, a.missing_endorsements::text, array_to_json(a.seating_plan)::text,
+		       a.distance_meters, a.restaurant_time_zone
+		FROM restaurant_alternatives($1::uuid[], $2::timestamptz, $3::timestamptz, $4::int, $5::jsonb,
+		                             $6::float8, $7::float8, $8::float8, $9, $10::jsonb,
+		                             make_interval(hours => $11), make_interval(mins => $12), $13) AS a;
+	`
+	rows, err := db.Query(query, pq.Array(req.DinerIDs), startTime, endTime,
+		req.Party.requestedSize(), req.Party.guestPreferencesJSON(), req.Lat, req.Lon, req.RadiusMeters, req.MatchMode,
+		req.Party.guestRestrictionsJSON(), req.WindowHours, req.IncrementMinutes, req.SlotsPerRestaurant)
+	if err != nil {
+		if hasSQLState(err, sqlStateEndorsementsNotMet) {
+			// No restaurants matched the given endorsements, at any time
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode([]map[string]string{})
+			return
+		}
+		writeDBError(w, err, "Error querying database")
+		return
+	}
+	defer rows.Close()
+
+	alternatives := []map[string]string{}
+	for rows.Next() {
+		var restaurantID, name, matchedEndorsements, missingEndorsements, seatingPlan, timeZone string
+		var slotStart, slotEnd time.Time
+		var offsetMinutes int
+		var distanceMeters sql.NullFloat64
+		if err := rows.Scan(&restaurantID, &name, &slotStart, &slotEnd, &offsetMinutes, &matchedEndorsements,
+			&missingEndorsements, &seatingPlan, &distanceMeters, &timeZone); err != nil {
+			writeError(w, http.StatusInternalServerError, errInternal, "Error scanning result", nil)
+			return
+		}
+		alternative := map[string]string{
+			"id":                  restaurantID,
+			"name":                name,
+			"startTime":           formatUTC(slotStart),
+			"endTime":             formatUTC(slotEnd),
+			"startTimeLocal":      formatLocal(slotStart, timeZone),
+			"endTimeLocal":        formatLocal(slotEnd, timeZone),
+			"timeZone":            timeZone,
+			"offsetMinutes":       strconv.Itoa(offsetMinutes),
+			"matchedEndorsements": matchedEndorsements,
+			"missingEndorsements": missingEndorsements,
+			"seatingPlan":         seatingPlan,
+		}
+		if distanceMeters.Valid {
+			alternative["distanceMeters"] = strconv.FormatFloat(distanceMeters.Float64, 'f', 0, 64)
+		}
+		alternatives = append(alternatives, alternative)
+	}
+
+	// Check for errors during rows iteration; the endorsement check may surface here rather than from Query
+	if err := rows.Err(); err != nil && !hasSQLState(err, sqlStateEndorsementsNotMet) {
+		writeDBError(w, err, "Error processing data")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(alternatives)
+}
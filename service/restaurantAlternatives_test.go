@@ -0,0 +1,45 @@
+package main
+
+import "testing"
+
+func TestValidateSearchSteps(t *testing.T) {
+	tests := []struct {
+		name        string
+		req         AlternativesRequest
+		wantErr     bool
+		wantWindow  int
+		wantStep    int
+		wantPerSlot int
+	}{
+		{name: "defaults", wantWindow: 2, wantStep: 15, wantPerSlot: 2},
+		{name: "wide window", req: AlternativesRequest{WindowHours: 12}, wantWindow: 12, wantStep: 15, wantPerSlot: 2},
+		{name: "fine step", req: AlternativesRequest{WindowHours: 4, IncrementMinutes: 5},
+			wantWindow: 4, wantStep: 5, wantPerSlot: 2},
+		{name: "too many start times", req: AlternativesRequest{WindowHours: 12, IncrementMinutes: 5}, wantErr: true},
+		{name: "window too wide", req: AlternativesRequest{WindowHours: 13, IncrementMinutes: 60}, wantErr: true},
+		{name: "step too fine", req: AlternativesRequest{IncrementMinutes: 1}, wantErr: true},
+		{name: "step longer than window", req: AlternativesRequest{WindowHours: 1, IncrementMinutes: 90}, wantErr: true},
+		{name: "too many per restaurant", req: AlternativesRequest{SlotsPerRestaurant: 11}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := tt.req
+			apiErr := req.validateSearchSteps()
+			if tt.wantErr {
+				if apiErr == nil {
+					t.Fatalf("validateSearchSteps() = nil, want an error")
+				}
+				return
+			}
+			if apiErr != nil {
+				t.Fatalf("validateSearchSteps() = %+v", apiErr)
+			}
+			if req.WindowHours != tt.wantWindow || req.IncrementMinutes != tt.wantStep ||
+				req.SlotsPerRestaurant != tt.wantPerSlot {
+				t.Errorf("got window %d, step %d, slots %d; want %d, %d, %d", req.WindowHours, req.IncrementMinutes,
+					req.SlotsPerRestaurant, tt.wantWindow, tt.wantStep, tt.wantPerSlot)
+			}
+		})
+	}
+}
@@ -5,66 +5,188 @@ import (
 	"encoding/json"
 	"github.com/lib/pq"
 	"net/http"
-	"strings"
+	"strconv"
 	"time"
 )
 
-// restaurantAvailability returns a list of restaurants that can accommodate the number of diners and are open during the specified time
-func restaurantAvailability(w http.ResponseWriter, r *http.Request, db *sql.DB) {
-	// Get query parameters
-	dinersUUIDStr := r.URL.Query().Get("dinerUUIDs")
-	startTimeStr := r.URL.Query().Get("startTime")
-	endTimeStr := r.URL.Query().Get("endTime")
+// AvailabilityRequest is the JSON body accepted by POST /restaurant/available
+type AvailabilityRequest struct {
+	Party
+	StartTime       string `json:"start_time"`
+	EndTime         string `json:"end_time"`
+	DurationMinutes int    `json:"duration_minutes"`
+	// Lat and Lon are where to search from, defaulting to the centre of the registered diners
+	Lat          *float64 `json:"lat"`
+	Lon          *float64 `json:"lon"`
+	RadiusMeters *float64 `json:"radius_meters"`
+	// MatchMode is "ranked" (the default) to return every restaurant meeting the party's dietary
+	// restrictions, ordered by how many of its preferences they meet, or "all" to require every
+	// preference as well
+	MatchMode string `json:"match_mode"`
+}
+
+// Endorsement match modes accepted by /restaurant/available
+const (
+	matchModeAll    = "all"
+	matchModeRanked = "ranked"
+)
 
-	dinerUUIDs := strings.Split(dinersUUIDStr, ",")
+// validateSearchArea checks the optional proximity search parameters
+func (req AvailabilityRequest) validateSearchArea() *APIError {
+	if (req.Lat == nil) != (req.Lon == nil) {
+		return &APIError{Code: errInvalidRequest, Message: "Latitude and longitude must be given together"}
+	}
+	if req.Lat != nil && (*req.Lat < -90 || *req.Lat > 90 || *req.Lon < -180 || *req.Lon > 180) {
+		return &APIError{Code: errInvalidRequest, Message: "Latitude or longitude out of range"}
+	}
+	if req.RadiusMeters != nil && *req.RadiusMeters <= 0 {
+		return &APIError{Code: errInvalidRequest, Message: "Radius must be positive"}
+	}
+	// without a point the search is centred on the diners, so a guest-only party has nowhere to measure from
+	if req.RadiusMeters != nil && req.Lat == nil && len(req.DinerIDs) == 0 {
+		return &APIError{Code: errInvalidRequest, Message: "A radius needs a latitude and longitude or registered diners to search from"}
+	}
+	return nil
+}
 
-	startTime, err := time.Parse(time.RFC3339, startTimeStr)
+// optionalFloatQuery reads an optional float query parameter
+func optionalFloatQuery(r *http.Request, name string) (*float64, *APIError) {
+	valueStr := r.URL.Query().Get(name)
+	if valueStr == "" {
+		return nil, nil
+	}
+	value, err := strconv.ParseFloat(valueStr, 64)
 	if err != nil {
-		http.Error(w, "Invalid start time", http.StatusBadRequest)
+		return nil, &APIError{Code: errInvalidRequest, Message: "Invalid " + name}
+	}
+	return &value, nil
+}
+
+// restaurantAvailability returns a list of restaurants that can accommodate the diners in a JSON request body
+func restaurantAvailability(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	var req AvailabilityRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, errInvalidRequest, "Invalid request body", nil)
 		return
 	}
-	endTime, err := time.Parse(time.RFC3339, endTimeStr)
-	if err != nil {
-		http.Error(w, "Invalid end time", http.StatusBadRequest)
+	findAvailability(w, db, req)
+}
+
+// restaurantAvailabilityQuery is the legacy GET form of restaurantAvailability, taking query parameters
+func restaurantAvailabilityQuery(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	// Get query parameters
+	party, apiErr := partyFromQuery(r)
+	if apiErr != nil {
+		writeError(w, http.StatusBadRequest, apiErr.Code, apiErr.Message, nil)
+		return
+	}
+	req := AvailabilityRequest{
+		Party:     party,
+		StartTime: r.URL.Query().Get("startTime"),
+		EndTime:   r.URL.Query().Get("endTime"),
+	}
+	if req.Lat, apiErr = optionalFloatQuery(r, "lat"); apiErr != nil {
+		writeError(w, http.StatusBadRequest, apiErr.Code, apiErr.Message, nil)
+		return
+	}
+	if req.Lon, apiErr = optionalFloatQuery(r, "lon"); apiErr != nil {
+		writeError(w, http.StatusBadRequest, apiErr.Code, apiErr.Message, nil)
+		return
+	}
+	if req.RadiusMeters, apiErr = optionalFloatQuery(r, "radiusMeters"); apiErr != nil {
+		writeError(w, http.StatusBadRequest, apiErr.Code, apiErr.Message, nil)
 		return
 	}
+	req.MatchMode = r.URL.Query().Get("matchMode")
+	findAvailability(w, db, req)
+}
+
+// resolve validates the search and works out its window, filling in the default match mode
+func (req *AvailabilityRequest) resolve() (time.Time, *time.Time, *APIError) {
+	startTime, endTime, apiErr := resolveWindow(req.StartTime, req.EndTime, req.DurationMinutes)
+	if apiErr != nil {
+		return startTime, endTime, apiErr
+	}
+
+	if apiErr := req.Party.validate(); apiErr != nil {
+		return startTime, endTime, apiErr
+	}
+	if apiErr := req.validateSearchArea(); apiErr != nil {
+		return startTime, endTime, apiErr
+	}
+	if req.MatchMode == "" {
+		req.MatchMode = matchModeRanked
+	}
+	if req.MatchMode != matchModeAll && req.MatchMode != matchModeRanked {
+		return startTime, endTime, &APIError{Code: errInvalidRequest, Message: "Match mode must be all or ranked"}
+	}
+	return startTime, endTime, nil
+}
 
-	if len(dinerUUIDs) == 0 || dinerUUIDs[0] == "" {
-		http.Error(w, "No valid UUIDs provided", http.StatusBadRequest)
+// findAvailability returns a list of restaurants that can accommodate the number of diners and are open during the specified time
+func findAvailability(w http.ResponseWriter, db *sql.DB, req AvailabilityRequest) {
+	startTime, endTime, apiErr := req.resolve()
+	if apiErr != nil {
+		writeError(w, http.StatusBadRequest, apiErr.Code, apiErr.Message, nil)
 		return
 	}
 
 	// Execute the SQL query to retrieve restaurant availability
 	query := `
-		SELECT r.restaurant_id, r.restaurant_name, r.matched_endorsements::text, r.message
-		FROM check_restaurant_availability($1::uuid[], $2, $3) AS r;
+		SELECT r.restaurant_id, r.restaurant_name, r.matched_endorsements::text, r.message,
+		       array_to_json(r.seating_plan)::text, r.reservation_end_time, r.distance_meters,
+		       r.missing_endorsements::text, r.restaurant_time_zone
+		FROM check_restaurant_availability($1::uuid[], $2::timestamptz, $3::timestamptz, $4::int, $5::jsonb,
+		                                   $6::float8, $7::float8, $8::float8, $9, $10::jsonb) AS r;
 	`
-	rows, err := db.Query(query, pq.Array(dinerUUIDs), startTime, endTime)
+	rows, err := db.Query(query, pq.Array(req.DinerIDs), startTime, endTime,
+		req.Party.requestedSize(), req.Party.guestPreferencesJSON(), req.Lat, req.Lon, req.RadiusMeters, req.MatchMode,
+		req.Party.guestRestrictionsJSON())
 	if err != nil {
-		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code.Name() == "raise_exception" {
+		if hasSQLState(err, sqlStateEndorsementsNotMet) {
 			// No restaurants matched the given endorsements
 			w.Header().Set("Content-Type", "application/json")
 			json.NewEncoder(w).Encode([]map[string]string{})
 			return
 		}
-		http.Error(w, "Error querying database", http.StatusInternalServerError)
+		writeDBError(w, err, "Error querying database")
 		return
 	}
 	defer rows.Close()
 
 	var availableRestaurants []map[string]string
 	for rows.Next() {
-		var restaurantID, name, matchedEndorsements, message string
-		if err := rows.Scan(&restaurantID, &name, &matchedEndorsements, &message); err != nil {
-			http.Error(w, "Error scanning result", http.StatusInternalServerError)
+		var restaurantID, name, matchedEndorsements, message, seatingPlan, missingEndorsements, timeZone string
+		var reservationEndTime time.Time
+		var distanceMeters sql.NullFloat64
+		if err := rows.Scan(&restaurantID, &name, &matchedEndorsements, &message, &seatingPlan, &reservationEndTime,
+			&distanceMeters, &missingEndorsements, &timeZone); err != nil {
+			writeError(w, http.StatusInternalServerError, errInternal, "Error scanning result", nil)
 			return
 		}
-		availableRestaurants = append(availableRestaurants, map[string]string{
+		restaurant := map[string]string{
 			"id":                  restaurantID,
 			"name":                name,
 			"matchedEndorsements": matchedEndorsements,
+			"missingEndorsements": missingEndorsements,
 			"message":             message,
-		})
+			"seatingPlan":         seatingPlan,
+			"startTime":           formatUTC(startTime),
+			"startTimeLocal":      formatLocal(startTime, timeZone),
+			"endTime":             formatUTC(reservationEndTime),
+			"endTimeLocal":        formatLocal(reservationEndTime, timeZone),
+			"timeZone":            timeZone,
+		}
+		if distanceMeters.Valid {
+			restaurant["distanceMeters"] = strconv.FormatFloat(distanceMeters.Float64, 'f', 0, 64)
+		}
+		availableRestaurants = append(availableRestaurants, restaurant)
+	}
+
+	// Check for errors during rows iteration; the endorsement check may surface here rather than from Query
+	if err := rows.Err(); err != nil && !hasSQLState(err, sqlStateEndorsementsNotMet) {
+		writeDBError(w, err, "Error processing data")
+		return
 	}
 
 	// Return the results as JSON
@@ -1,58 +1,238 @@
 package main
 
 import (
+	"crypto/sha256"
 	"database/sql"
+	"encoding/hex"
 	"encoding/json"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/janearc/bourdain/core"
 	"github.com/lib/pq"
+	"github.com/sirupsen/logrus"
 	"net/http"
+	"sort"
 	"strings"
 	"time"
 )
 
-// restaurantBook reserves a restaurant for the given number of diners
+// maxBookingAttempts is how many times a booking is attempted when it fails in a way worth retrying
+const maxBookingAttempts = 4
+
+// bookingBackoff spaces out booking retries so that bookings which collided don't collide again
+var bookingBackoff = core.Backoff{Initial: 20 * time.Millisecond, Max: 500 * time.Millisecond}
+
+// isBookingConflict reports whether err is the reservation_tops exclusion constraint rejecting a
+// table that a concurrent booking claimed first; trying again will pick different tables
+func isBookingConflict(err error) bool {
+	return hasSQLState(err, "23P01") // exclusion_violation
+}
+
+// shouldRetryBooking reports whether a failed booking transaction is worth another attempt. Losing a
+// table, a serialization failure and a deadlock all roll the transaction back, so retrying is safe. A
+// dropped connection may have lost the reply to a booking that committed, so that is only retried when
+// the call is idempotent and a repeat would return the original result.
+func shouldRetryBooking(err error, idempotent bool) bool {
+	switch {
+	case err == nil:
+		return false
+	case isBookingConflict(err), core.IsSerializationFailure(err):
+		return true
+	case core.IsConnectionError(err):
+		return idempotent
+	}
+	return false
+}
+
+// retryBooking runs attempt until it succeeds, fails in a way not worth retrying, or runs out of attempts
+func retryBooking(idempotent bool, attempt func() error) error {
+	var err error
+	for try := 1; try <= maxBookingAttempts; try++ {
+		err = attempt()
+		if !shouldRetryBooking(err, idempotent) || try == maxBookingAttempts {
+			break
+		}
+		delay := bookingBackoff.Delay(try)
+		logrus.Debugf("Booking attempt %d failed, retrying in %v: %v", try, delay, err)
+		time.Sleep(delay)
+	}
+	return err
+}
+
+// idempotencyKeyHeader lets clients retry a booking safely: repeats with the same key and payload
+// return the original reservation rather than booking again
+const idempotencyKeyHeader = "Idempotency-Key"
+
+// maxIdempotencyKeyLength matches the idempotency_keys.idempotency_key column
+const maxIdempotencyKeyLength = 255
+
+// clientIDHeader identifies the client sending a request. Idempotency keys are only compared with
+// others from the same client, or when there is no client ID, with others booking the same diners.
+const clientIDHeader = "X-Client-ID"
+
+// BookingRequest is the JSON body accepted by POST /restaurant/book
+type BookingRequest struct {
+	Party
+	RestaurantID    string `json:"restaurant_id"`
+	StartTime       string `json:"start_time"`
+	EndTime         string `json:"end_time"`
+	DurationMinutes int    `json:"duration_minutes"`
+	Notes           string `json:"notes"`
+}
+
+// restaurantBook reserves a restaurant for the diners in a JSON request body
 func restaurantBook(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	var req BookingRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, errInvalidRequest, "Invalid request body", nil)
+		return
+	}
+	bookRestaurant(w, db, req, r.Header.Get(idempotencyKeyHeader), r.Header.Get(clientIDHeader))
+}
+
+// restaurantBookQuery is the legacy GET form of restaurantBook, taking query parameters
+func restaurantBookQuery(w http.ResponseWriter, r *http.Request, db *sql.DB) {
 	// Get query parameters
-	startTimeStr := r.URL.Query().Get("startTime")
-	endTimeStr := r.URL.Query().Get("endTime")
-	dinerUUIDStr := r.URL.Query().Get("dinerUUIDs")
-	restaurantUUID := r.URL.Query().Get("restaurantUUID")
+	party, apiErr := partyFromQuery(r)
+	if apiErr != nil {
+		writeError(w, http.StatusBadRequest, apiErr.Code, apiErr.Message, nil)
+		return
+	}
+	req := BookingRequest{
+		Party:        party,
+		RestaurantID: r.URL.Query().Get("restaurantUUID"),
+		StartTime:    r.URL.Query().Get("startTime"),
+		EndTime:      r.URL.Query().Get("endTime"),
+	}
+	bookRestaurant(w, db, req, r.Header.Get(idempotencyKeyHeader), r.Header.Get(clientIDHeader))
+}
 
-	// Validate required parameters
-	if startTimeStr == "" || endTimeStr == "" || dinerUUIDStr == "" || restaurantUUID == "" {
-		http.Error(w, "Missing required parameters", http.StatusBadRequest)
+// normalizedDinerIDs returns the request's diner IDs sorted and lower-cased, so that neither order nor
+// case makes two requests differ
+func normalizedDinerIDs(req BookingRequest) []string {
+	dinerIDs := make([]string, len(req.DinerIDs))
+	for i, id := range req.DinerIDs {
+		dinerIDs[i] = strings.ToLower(strings.TrimSpace(id))
+	}
+	sort.Strings(dinerIDs)
+	return dinerIDs
+}
+
+// idempotencyScope fingerprints who an idempotency key belongs to: the client, when it identifies
+// itself, or else the diners being booked
+func idempotencyScope(req BookingRequest, clientID string) string {
+	scope := "diners:" + strings.Join(normalizedDinerIDs(req), ",")
+	if clientID != "" {
+		scope = "client:" + clientID
+	}
+	sum := sha256.Sum256([]byte(scope))
+	return hex.EncodeToString(sum[:])
+}
+
+// bookingRequestHash fingerprints a booking so that a reused idempotency key can be told apart from a
+// genuine retry. Diner order and ID case do not matter, and times are compared as instants.
+func bookingRequestHash(req BookingRequest, startTime time.Time, endTime *time.Time) string {
+	dinerIDs := normalizedDinerIDs(req)
+
+	end := ""
+	if endTime != nil {
+		end = endTime.UTC().Format(time.RFC3339)
+	}
+
+	guestPrefs := append([]string{}, req.GuestPreferences...)
+	sort.Strings(guestPrefs)
+	guestRestrictions := append([]string{}, req.GuestRestrictions...)
+	sort.Strings(guestRestrictions)
+
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%s\n%s\n%d\n%s\n%s\n%s\n%s\n%s",
+		strings.ToLower(req.RestaurantID),
+		strings.Join(dinerIDs, ","),
+		req.PartySize,
+		strings.Join(guestPrefs, ","),
+		strings.Join(guestRestrictions, ","),
+		startTime.UTC().Format(time.RFC3339),
+		end,
+		req.Notes)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// bookRestaurant reserves a restaurant for the given diners, deduplicating on the client's idempotencyKey
+// when one is given
+func bookRestaurant(w http.ResponseWriter, db *sql.DB, req BookingRequest, idempotencyKey, clientID string) {
+	if len(idempotencyKey) > maxIdempotencyKeyLength {
+		writeError(w, http.StatusBadRequest, errInvalidRequest, "Idempotency key is too long", nil)
 		return
 	}
 
-	// Parse start and end times
-	startTime, err := time.Parse(time.RFC3339, startTimeStr)
-	if err != nil {
-		http.Error(w, "Invalid start time format", http.StatusBadRequest)
+	// Validate required parameters
+	if req.StartTime == "" || req.RestaurantID == "" {
+		writeError(w, http.StatusBadRequest, errInvalidRequest, "Missing required parameters", nil)
 		return
 	}
-	endTime, err := time.Parse(time.RFC3339, endTimeStr)
-	if err != nil {
-		http.Error(w, "Invalid end time format", http.StatusBadRequest)
+	if apiErr := req.Party.validate(); apiErr != nil {
+		writeError(w, http.StatusBadRequest, apiErr.Code, apiErr.Message, nil)
 		return
 	}
 
-	// Split diner UUIDs into a slice
-	dinerUUIDs := strings.Split(dinerUUIDStr, ",")
+	// Work out the reservation window
+	startTime, endTime, apiErr := resolveWindow(req.StartTime, req.EndTime, req.DurationMinutes)
+	if apiErr != nil {
+		writeError(w, http.StatusBadRequest, apiErr.Code, apiErr.Message, nil)
+		return
+	}
 
 	// Prepare the SQL call to the stored procedure
-	query := `SELECT public.restaurant_book($1::uuid, $2::uuid[], $3::timestamp, $4::timestamp)`
+	query := `SELECT public.restaurant_book($1::uuid, $2::uuid[], $3::timestamptz, $4::timestamptz, NULLIF($5::text, ''), $6::int,
+		$7::jsonb, $8::jsonb)`
+	args := []interface{}{req.RestaurantID, pq.Array(req.DinerIDs), startTime, endTime, req.Notes,
+		req.Party.requestedSize(), req.Party.guestPreferencesJSON(), req.Party.guestRestrictionsJSON()}
+	if idempotencyKey != "" {
+		// every attempt at this request shares its ID, so that one finding the booking a lost attempt
+		// committed is not taken for the client replaying an earlier request
+		query = `SELECT reservation_id, replayed, reservation_status
+			FROM public.restaurant_book_idempotent($9, $10, $11, $12::uuid, $1::uuid, $2::uuid[], $3::timestamptz,
+			                                       $4::timestamptz, NULLIF($5::text, ''), $6::int, $7::jsonb, $8::jsonb)`
+		args = append(args, idempotencyScope(req, clientID), idempotencyKey, bookingRequestHash(req, startTime, endTime),
+			uuid.NewString())
+	}
 
-	// Call the stored procedure
+	// Call the stored procedure, retrying if a concurrent booking took one of our tables or the
+	// transaction otherwise failed transiently
 	var reservationUUID string
-	err = db.QueryRow(query, restaurantUUID, pq.Array(dinerUUIDs), startTime, endTime).Scan(&reservationUUID)
+	var replayed bool
+	reservationStatus := "confirmed"
+	err := retryBooking(idempotencyKey != "", func() error {
+		var err error
+		if idempotencyKey != "" {
+			err = db.QueryRow(query, args...).Scan(&reservationUUID, &replayed, &reservationStatus)
+		} else {
+			err = db.QueryRow(query, args...).Scan(&reservationUUID)
+		}
+		return err
+	})
 	if err != nil {
-		http.Error(w, "Error creating reservation", http.StatusInternalServerError)
+		writeDBError(w, err, "Error creating reservation")
+		return
+	}
+
+	if replayed {
+		w.Header().Set("Idempotent-Replayed", "true")
+	}
+
+	// A replayed booking may have been cancelled since; don't let the client think it still holds it
+	if reservationStatus == "cancelled" {
+		writeError(w, http.StatusConflict, errReservationCancelled,
+			"The reservation made with this idempotency key has since been cancelled",
+			map[string]string{"reservation_id": reservationUUID})
 		return
 	}
 
 	// Respond with the new reservation UUID
 	response := map[string]string{
-		"status":         "success",
-		"reservation_id": reservationUUID,
+		"status":             "success",
+		"reservation_id":     reservationUUID,
+		"reservation_status": reservationStatus,
 	}
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"database/sql/driver"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+func TestBookingRequestHash(t *testing.T) {
+	start := time.Date(2024, 10, 14, 22, 0, 0, 0, time.UTC)
+	end := start.Add(2 * time.Hour)
+	base := BookingRequest{
+		Party: Party{
+			DinerIDs:          []string{"6F1C0C7E-0000-4000-8000-000000000001", "6f1c0c7e-0000-4000-8000-000000000002"},
+			PartySize:         4,
+			GuestRestrictions: []string{"kosher", "gluten-free"},
+			GuestPreferences:  []string{"organic", "kid-friendly"},
+		},
+		RestaurantID: "0B7A4C1E-0000-4000-8000-00000000000A",
+		Notes:        "window seat",
+	}
+	want := bookingRequestHash(base, start, &end)
+
+	same := base
+	same.Party.DinerIDs = []string{" 6f1c0c7e-0000-4000-8000-000000000002", "6f1c0c7e-0000-4000-8000-000000000001"}
+	same.Party.GuestRestrictions = []string{"gluten-free", "kosher"}
+	same.Party.GuestPreferences = []string{"kid-friendly", "organic"}
+	same.RestaurantID = "0b7a4c1e-0000-4000-8000-00000000000a"
+	newYork := time.FixedZone("EDT", -4*60*60)
+	if got := bookingRequestHash(same, start.In(newYork), timePtr(end.In(newYork))); got != want {
+		t.Errorf("hash changed with diner order, ID case, tag order or time zone")
+	}
+
+	for name, change := range map[string]func(req *BookingRequest, start, end *time.Time){
+		"diner":             func(req *BookingRequest, _, _ *time.Time) { req.Party.DinerIDs = req.Party.DinerIDs[:1] },
+		"party size":        func(req *BookingRequest, _, _ *time.Time) { req.Party.PartySize = 5 },
+		"restriction":       func(req *BookingRequest, _, _ *time.Time) { req.Party.GuestRestrictions = []string{"kosher"} },
+		"preference":        func(req *BookingRequest, _, _ *time.Time) { req.Party.GuestPreferences = nil },
+		"restaurant":        func(req *BookingRequest, _, _ *time.Time) { req.RestaurantID = "another" },
+		"notes":             func(req *BookingRequest, _, _ *time.Time) { req.Notes = "" },
+		"start time":        func(_ *BookingRequest, start, _ *time.Time) { *start = start.Add(time.Minute) },
+		"end time":          func(_ *BookingRequest, _, end *time.Time) { *end = end.Add(time.Minute) },
+		"end time left out": nil,
+	} {
+		req, changedStart, changedEnd := base, start, end
+		req.Party.DinerIDs = append([]string{}, base.Party.DinerIDs...)
+		endPtr := &changedEnd
+		if change == nil {
+			endPtr = nil
+		} else {
+			change(&req, &changedStart, &changedEnd)
+		}
+		if got := bookingRequestHash(req, changedStart, endPtr); got == want {
+			t.Errorf("hash unchanged when the %s changed", name)
+		}
+	}
+}
+
+func TestIdempotencyScope(t *testing.T) {
+	req := BookingRequest{Party: Party{DinerIDs: []string{"B", "a"}}}
+	reordered := BookingRequest{Party: Party{DinerIDs: []string{"A", "b"}}}
+	other := BookingRequest{Party: Party{DinerIDs: []string{"a", "c"}}}
+
+	if idempotencyScope(req, "") != idempotencyScope(reordered, "") {
+		t.Errorf("scope depends on diner order or case")
+	}
+	if idempotencyScope(req, "") == idempotencyScope(other, "") {
+		t.Errorf("different diners share a scope")
+	}
+	if idempotencyScope(req, "client-1") != idempotencyScope(other, "client-1") {
+		t.Errorf("a client's scope depends on the diners")
+	}
+	if idempotencyScope(req, "client-1") == idempotencyScope(req, "client-2") {
+		t.Errorf("different clients share a scope")
+	}
+	if len(idempotencyScope(req, "")) != 64 {
+		t.Errorf("scope %q does not fit idempotency_keys.scope", idempotencyScope(req, ""))
+	}
+}
+
+func TestShouldRetryBooking(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		idempotent bool
+		want       bool
+	}{
+		{"success", nil, true, false},
+		{"table taken", &pq.Error{Code: "23P01"}, false, true},
+		{"serialization failure", &pq.Error{Code: "40001"}, false, true},
+		{"deadlock", &pq.Error{Code: "40P01"}, false, true},
+		{"lost connection", driver.ErrBadConn, false, false},
+		{"lost connection, idempotent", driver.ErrBadConn, true, true},
+		{"no tables", &pq.Error{Code: sqlStateNoTablesAvailable}, true, false},
+		{"diner conflict", &pq.Error{Code: sqlStateDinerConflict}, true, false},
+	}
+	for _, tt := range tests {
+		if got := shouldRetryBooking(tt.err, tt.idempotent); got != tt.want {
+			t.Errorf("shouldRetryBooking(%s) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"net/http"
+	"time"
+)
+
+// Defaults and limits for the next available slot search
+const (
+	defaultNextAvailableRange     = 3 * 24 * time.Hour
+	maxNextAvailableRange         = 7 * 24 * time.Hour
+	defaultNextAvailableStepMins  = 15
+	minNextAvailableStepMins      = 15
+	defaultNextAvailableSlotCount = 5
+	maxNextAvailableSlotCount     = 50
+)
+
+// NextAvailableRequest is the JSON body accepted by POST /restaurant/{id}/next_available. From and To
+// bound the start times searched; To defaults to three days after From, and may be at most a week
+// after it. With no duration, each slot lasts the restaurant's turn time for the party. As when
+// booking, the restaurant must meet the guests' restrictions as well as the diners'.
+type NextAvailableRequest struct {
+	Party
+	From             string `json:"from"`
+	To               string `json:"to"`
+	DurationMinutes  int    `json:"duration_minutes"`
+	IncrementMinutes int    `json:"increment_minutes"`
+	Count            int    `json:"count"`
+}
+
+// AvailableSlot is a start time at which the restaurant could take the party, given both in UTC and
+// in the restaurant's local time
+type AvailableSlot struct {
+	StartTime      string `json:"start_time"`
+	EndTime        string `json:"end_time"`
+	StartTimeLocal string `json:"start_time_local"`
+	EndTimeLocal   string `json:"end_time_local"`
+	SeatingPlan    []int  `json:"seating_plan"`
+}
+
+// resolveRange validates the search range and fills in the defaults
+func (req *NextAvailableRequest) resolveRange() (time.Time, time.Time, *APIError) {
+	from, err := time.Parse(time.RFC3339, req.From)
+	if err != nil {
+		return time.Time{}, time.Time{}, &APIError{Code: errInvalidTime, Message: "Invalid from time format"}
+	}
+	to := from.Add(defaultNextAvailableRange)
+	if req.To != "" {
+		if to, err = time.Parse(time.RFC3339, req.To); err != nil {
+			return time.Time{}, time.Time{}, &APIError{Code: errInvalidTime, Message: "Invalid to time format"}
+		}
+	}
+
+	if req.IncrementMinutes == 0 {
+		req.IncrementMinutes = defaultNextAvailableStepMins
+	}
+	if req.Count == 0 {
+		req.Count = defaultNextAvailableSlotCount
+	}
+
+	switch {
+	case to.Before(from):
+		return from, to, &APIError{Code: errInvalidTimeWindow, Message: "Search range must end after it starts"}
+	case to.Sub(from) > maxNextAvailableRange:
+		return from, to, &APIError{Code: errInvalidTimeWindow, Message: "Search range is too long"}
+	case req.DurationMinutes < 0:
+		return from, to, &APIError{Code: errInvalidTimeWindow, Message: "Duration must be positive"}
+	case req.IncrementMinutes < minNextAvailableStepMins:
+		return from, to, &APIError{Code: errInvalidRequest,
+			Message: fmt.Sprintf("Increment must be at least %d minutes", minNextAvailableStepMins)}
+	case req.Count < 0 || req.Count > maxNextAvailableSlotCount:
+		return from, to, &APIError{Code: errInvalidRequest,
+			Message: fmt.Sprintf("Count must be between 1 and %d", maxNextAvailableSlotCount)}
+	}
+	return from, to, nil
+}
+
+// restaurantNextAvailable returns the earliest times at which a restaurant could seat the party
+func restaurantNextAvailable(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	restaurantUUID := r.PathValue("id")
+	if _, err := uuid.Parse(restaurantUUID); err != nil {
+		writeError(w, http.StatusBadRequest, errInvalidID, "Invalid restaurant ID", nil)
+		return
+	}
+
+	var req NextAvailableRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, errInvalidRequest, "Invalid request body", nil)
+		return
+	}
+
+	if apiErr := req.Party.validate(); apiErr != nil {
+		writeError(w, http.StatusBadRequest, apiErr.Code, apiErr.Message, nil)
+		return
+	}
+	from, to, apiErr := req.resolveRange()
+	if apiErr != nil {
+		writeError(w, http.StatusBadRequest, apiErr.Code, apiErr.Message, nil)
+		return
+	}
+
+	var slotMinutes *int
+	if req.DurationMinutes > 0 {
+		slotMinutes = &req.DurationMinutes
+	}
+
+	query := `
+		SELECT s.slot_start, s.slot_end, array_to_json(s.seating_plan)::text, s.restaurant_time_zone
+		FROM restaurant_next_available($1::uuid, $2::uuid[], $3::timestamptz, $4::timestamptz, $5::int,
+		                               make_interval(mins => $6::int), make_interval(mins => $7), $8,
+		                               $9::jsonb, $10::jsonb) AS s;
+	`
+	rows, err := db.Query(query, restaurantUUID, pq.Array(req.DinerIDs), from, to, req.Party.requestedSize(),
+		slotMinutes, req.IncrementMinutes, req.Count, req.Party.guestPreferencesJSON(), req.Party.guestRestrictionsJSON())
+	if err != nil {
+		writeDBError(w, err, "Error querying database")
+		return
+	}
+	defer rows.Close()
+
+	slots := []AvailableSlot{}
+	var timeZone string
+	for rows.Next() {
+		var slotStart, slotEnd time.Time
+		var seatingPlan string
+		if err := rows.Scan(&slotStart, &slotEnd, &seatingPlan, &timeZone); err != nil {
+			writeError(w, http.StatusInternalServerError, errInternal, "Error scanning result", nil)
+			return
+		}
+		slot := AvailableSlot{
+			StartTime:      formatUTC(slotStart),
+			EndTime:        formatUTC(slotEnd),
+			StartTimeLocal: formatLocal(slotStart, timeZone),
+			EndTimeLocal:   formatLocal(slotEnd, timeZone),
+		}
+		if err := json.Unmarshal([]byte(seatingPlan), &slot.SeatingPlan); err != nil {
+			writeError(w, http.StatusInternalServerError, errInternal, "Error scanning result", nil)
+			return
+		}
+		slots = append(slots, slot)
+	}
+
+	// Errors raised by the function may surface here rather than from Query
+	if err := rows.Err(); err != nil {
+		writeDBError(w, err, "Error processing data")
+		return
+	}
+
+	response := map[string]interface{}{
+		"restaurant_id": restaurantUUID,
+		"slots":         slots,
+	}
+	if timeZone != "" {
+		response["time_zone"] = timeZone
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"github.com/google/uuid"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// RestaurantChange is the JSON body accepted by PATCH /restaurant/{id}; omitted fields are left unchanged
+type RestaurantChange struct {
+	Name         *string   `json:"name"`
+	Endorsements *[]string `json:"endorsements"`
+	// TimeZone is the IANA zone the restaurant's opening hours are in, e.g. "Europe/Paris"
+	TimeZone *string `json:"time_zone"`
+}
+
+// restaurantUpdate changes a restaurant's name, endorsements or time zone, rejecting endorsements that are not
+// in the vocabulary
+func restaurantUpdate(w http.ResponseWriter, r *http.Request, db *sql.DB) {
+	restaurantUUID := r.PathValue("id")
+	if _, err := uuid.Parse(restaurantUUID); err != nil {
+		writeError(w, http.StatusBadRequest, errInvalidID, "Invalid restaurant ID", nil)
+		return
+	}
+
+	var change RestaurantChange
+	if err := json.NewDecoder(r.Body).Decode(&change); err != nil {
+		writeError(w, http.StatusBadRequest, errInvalidRequest, "Invalid request body", nil)
+		return
+	}
+
+	if change.Name != nil && strings.TrimSpace(*change.Name) == "" {
+		writeError(w, http.StatusBadRequest, errInvalidRequest, "Restaurant name cannot be empty", nil)
+		return
+	}
+
+	if change.TimeZone != nil {
+		// "" and "Local" load in Go but mean nothing to the database
+		if _, err := time.LoadLocation(*change.TimeZone); err != nil || *change.TimeZone == "" || *change.TimeZone == "Local" {
+			writeError(w, http.StatusBadRequest, errInvalidRequest, "Unknown time zone", nil)
+			return
+		}
+	}
+
+	query := `SELECT public.restaurant_update($1::uuid, $2, $3::jsonb, $4)::text`
+	var updatedUUID string
+	err := db.QueryRow(query, restaurantUUID, change.Name, optionalTagsJSON(change.Endorsements), change.TimeZone).
+		Scan(&updatedUUID)
+	if err != nil {
+		writeDBError(w, err, "Error updating restaurant")
+		return
+	}
+
+	response := map[string]string{
+		"status":        "success",
+		"restaurant_id": updatedUUID,
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
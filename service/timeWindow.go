@@ -0,0 +1,68 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// resolveWindow turns a request's RFC3339 start time plus either an RFC3339 end time or a duration
+// in minutes into a reservation window. An explicit end time wins over a duration. When neither is
+// given the end time is nil and the database derives it from the restaurant's turn time.
+func resolveWindow(startTimeStr, endTimeStr string, durationMinutes int) (time.Time, *time.Time, *APIError) {
+	startTime, err := time.Parse(time.RFC3339, startTimeStr)
+	if err != nil {
+		return time.Time{}, nil, &APIError{Code: errInvalidTime, Message: "Invalid start time format"}
+	}
+
+	var endTime time.Time
+	switch {
+	case endTimeStr != "":
+		if endTime, err = time.Parse(time.RFC3339, endTimeStr); err != nil {
+			return time.Time{}, nil, &APIError{Code: errInvalidTime, Message: "Invalid end time format"}
+		}
+	case durationMinutes < 0:
+		return time.Time{}, nil, &APIError{Code: errInvalidTimeWindow, Message: "Duration must be positive"}
+	case durationMinutes > 0:
+		endTime = startTime.Add(time.Duration(durationMinutes) * time.Minute)
+	default:
+		return startTime, nil, nil
+	}
+
+	if !endTime.After(startTime) {
+		return time.Time{}, nil, &APIError{Code: errInvalidTimeWindow, Message: "End time must be after start time"}
+	}
+	return startTime, &endTime, nil
+}
+
+// formatUTC formats an instant for API responses, always in UTC
+func formatUTC(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
+
+// locations caches loaded time zones by name, since loading one re-parses it from the zone database
+var locations sync.Map
+
+// loadLocation returns the named time zone, loading it only the first time it is asked for
+func loadLocation(timeZone string) (*time.Location, error) {
+	if location, found := locations.Load(timeZone); found {
+		return location.(*time.Location), nil
+	}
+	location, err := time.LoadLocation(timeZone)
+	if err != nil {
+		return nil, err
+	}
+	locations.Store(timeZone, location)
+	return location, nil
+}
+
+// formatLocal formats an instant in a restaurant's IANA time zone, falling back to UTC if the zone is unknown
+func formatLocal(t time.Time, timeZone string) string {
+	location, err := loadLocation(timeZone)
+	if err != nil {
+		logrus.Warnf("Unknown time zone %q: %v", timeZone, err)
+		return formatUTC(t)
+	}
+	return t.In(location).Format(time.RFC3339)
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestResolveWindow(t *testing.T) {
+	start := time.Date(2024, 10, 14, 18, 0, 0, 0, time.FixedZone("EDT", -4*60*60))
+
+	tests := []struct {
+		name            string
+		startTime       string
+		endTime         string
+		durationMinutes int
+		wantEnd         *time.Time
+		wantCode        string
+	}{
+		{name: "end time", startTime: "2024-10-14T18:00:00-04:00", endTime: "2024-10-14T20:30:00-04:00",
+			wantEnd: timePtr(start.Add(150 * time.Minute))},
+		{name: "end time in another zone", startTime: "2024-10-14T18:00:00-04:00", endTime: "2024-10-14T23:00:00Z",
+			wantEnd: timePtr(start.Add(time.Hour))},
+		{name: "duration", startTime: "2024-10-14T18:00:00-04:00", durationMinutes: 90,
+			wantEnd: timePtr(start.Add(90 * time.Minute))},
+		{name: "end time wins over duration", startTime: "2024-10-14T18:00:00-04:00", endTime: "2024-10-14T19:00:00-04:00",
+			durationMinutes: 90, wantEnd: timePtr(start.Add(time.Hour))},
+		{name: "neither leaves the end to the restaurant", startTime: "2024-10-14T18:00:00-04:00"},
+		{name: "bad start", startTime: "6pm", wantCode: errInvalidTime},
+		{name: "missing start", wantCode: errInvalidTime},
+		{name: "bad end", startTime: "2024-10-14T18:00:00-04:00", endTime: "8pm", wantCode: errInvalidTime},
+		{name: "negative duration", startTime: "2024-10-14T18:00:00-04:00", durationMinutes: -30,
+			wantCode: errInvalidTimeWindow},
+		{name: "end before start", startTime: "2024-10-14T18:00:00-04:00", endTime: "2024-10-14T17:00:00-04:00",
+			wantCode: errInvalidTimeWindow},
+		{name: "end at start", startTime: "2024-10-14T18:00:00-04:00", endTime: "2024-10-14T22:00:00Z",
+			wantCode: errInvalidTimeWindow},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotStart, gotEnd, apiErr := resolveWindow(tt.startTime, tt.endTime, tt.durationMinutes)
+			if tt.wantCode != "" {
+				if apiErr == nil || apiErr.Code != tt.wantCode {
+					t.Fatalf("resolveWindow() error = %+v, want code %q", apiErr, tt.wantCode)
+				}
+				return
+			}
+			if apiErr != nil {
+				t.Fatalf("resolveWindow() error = %+v", apiErr)
+			}
+			if !gotStart.Equal(start) {
+				t.Errorf("start = %v, want %v", gotStart, start)
+			}
+			switch {
+			case tt.wantEnd == nil && gotEnd != nil:
+				t.Errorf("end = %v, want nil", *gotEnd)
+			case tt.wantEnd != nil && (gotEnd == nil || !gotEnd.Equal(*tt.wantEnd)):
+				t.Errorf("end = %v, want %v", gotEnd, *tt.wantEnd)
+			}
+		})
+	}
+}
+
+func TestFormatTimes(t *testing.T) {
+	instant := time.Date(2024, 10, 14, 22, 0, 0, 0, time.FixedZone("EDT", -4*60*60))
+
+	if got, want := formatUTC(instant), "2024-10-15T02:00:00Z"; got != want {
+		t.Errorf("formatUTC() = %q, want %q", got, want)
+	}
+
+	tests := []struct {
+		timeZone string
+		want     string
+	}{
+		{"America/New_York", "2024-10-14T22:00:00-04:00"},
+		{"Europe/Paris", "2024-10-15T04:00:00+02:00"},
+		{"Asia/Kolkata", "2024-10-15T07:30:00+05:30"},
+		{"Not/A_Zone", "2024-10-15T02:00:00Z"},
+	}
+	for _, tt := range tests {
+		// Twice, so that the cached zone is used the second time
+		for i := 0; i < 2; i++ {
+			if got := formatLocal(instant, tt.timeZone); got != tt.want {
+				t.Errorf("formatLocal(%q) = %q, want %q", tt.timeZone, got, tt.want)
+			}
+		}
+	}
+}
+
+func timePtr(t time.Time) *time.Time {
+	return &t
+}
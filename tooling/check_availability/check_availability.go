@@ -1,13 +1,13 @@
 package main
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"github.com/sirupsen/logrus"
 	"io"
 	"math/rand"
 	"net/http"
-	"strings"
 	"time"
 )
 
@@ -21,9 +21,24 @@ type Restaurant struct {
 
 type Reservation struct {
 	RestaurantID string   `json:"restaurant_id"`
-	DinerUUIDs   []string `json:"diner_uuids"`
+	DinerUUIDs   []string `json:"diner_ids"`
 	StartTime    string   `json:"start_time"`
-	EndTime      string   `json:"end_time"`
+	EndTime      string   `json:"end_time,omitempty"`
+}
+
+type AvailabilityRequest struct {
+	DinerUUIDs []string `json:"diner_ids"`
+	StartTime  string   `json:"start_time"`
+	EndTime    string   `json:"end_time,omitempty"`
+}
+
+// postJSON POSTs the given value as a JSON body
+func postJSON(url string, value interface{}) (*http.Response, error) {
+	body, err := json.Marshal(value)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding request: %v", err)
+	}
+	return http.Post(url, "application/json", bytes.NewReader(body))
 }
 
 // Generates a random number of diners for a party
@@ -39,28 +54,20 @@ func generatePartySize() int {
 	}
 }
 
-// Generate random reservation times
-func randomReservationTime() (time.Time, time.Time) {
+// Generate a random reservation start time; the service works out when it ends from the restaurant's turn time
+func randomReservationTime() time.Time {
 	startHour := rand.Intn(24)
 	startMinute := rand.Intn(4) * 15
 	now := time.Now()
-	startTime := time.Date(now.Year(), now.Month(), now.Day(), startHour, startMinute, 0, 0, time.UTC)
-
-	minDuration := 30
-	maxDuration := 120
-	randomDurationMinutes := rand.Intn((maxDuration-minDuration)/15+1)*15 + minDuration
-	endTime := startTime.Add(time.Duration(randomDurationMinutes) * time.Minute)
-
-	return startTime, endTime
+	return time.Date(now.Year(), now.Month(), now.Day(), startHour, startMinute, 0, 0, time.UTC)
 }
 
 // Check availability via the /restaurant/available endpoint
-func checkAvailability(dinerUUIDs []string, startTime, endTime time.Time) ([]Restaurant, error) {
-	dinerUUIDStr := strings.Join(dinerUUIDs, ",")
-	url := fmt.Sprintf("http://localhost:8080/restaurant/available?startTime=%s&endTime=%s&dinerUUIDs=%s",
-		startTime.Format(time.RFC3339), endTime.Format(time.RFC3339), dinerUUIDStr)
-
-	resp, err := http.Get(url)
+func checkAvailability(dinerUUIDs []string, startTime time.Time) ([]Restaurant, error) {
+	resp, err := postJSON("http://localhost:8080/restaurant/available", AvailabilityRequest{
+		DinerUUIDs: dinerUUIDs,
+		StartTime:  startTime.Format(time.RFC3339),
+	})
 	if err != nil {
 		return nil, fmt.Errorf("error hitting availability endpoint: %v", err)
 	}
@@ -89,12 +96,7 @@ func bookReservation(reservation Reservation) error {
 		return fmt.Errorf("restaurant ID is missing")
 	}
 
-	url := fmt.Sprintf(
-		"http://localhost:8080/restaurant/book?startTime=%s&endTime=%s&dinerUUIDs=%s&restaurantUUID=%s",
-		reservation.StartTime, reservation.EndTime, strings.Join(reservation.DinerUUIDs, ","), reservation.RestaurantID,
-	)
-
-	resp, err := http.Get(url)
+	resp, err := postJSON("http://localhost:8080/restaurant/book", reservation)
 	if err != nil {
 		return err
 	}
@@ -139,9 +141,9 @@ func main() {
 			continue
 		}
 
-		startTime, endTime := randomReservationTime()
+		startTime := randomReservationTime()
 
-		availableRestaurants, err := checkAvailability(dinerUUIDs, startTime, endTime)
+		availableRestaurants, err := checkAvailability(dinerUUIDs, startTime)
 		if err != nil {
 			logrus.Errorf("Error checking availability: %v", err)
 			continue
@@ -153,7 +155,6 @@ func main() {
 				RestaurantID: selectedRestaurant.ID,
 				DinerUUIDs:   dinerUUIDs,
 				StartTime:    startTime.Format(time.RFC3339),
-				EndTime:      endTime.Format(time.RFC3339),
 			}
 
 			err = bookReservation(reservation)
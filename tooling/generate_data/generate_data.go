@@ -16,24 +16,13 @@ import (
 // Initialize a local random generator
 var rng = rand.New(rand.NewSource(time.Now().UnixNano()))
 
-// createDatabase enables necessary extensions and configures the database.
+// createDatabase configures the database; extensions are created by the first migration.
 func createDatabase(db *sql.DB) {
 	dbName, err := core.GetCurrentDatabase(db)
 	if err != nil {
 		logrus.Fatalf("Error getting current database: %v", err)
 	}
 
-	// Enable extensions: uuid-ossp, PostGIS
-	extensions := []string{
-		`CREATE EXTENSION IF NOT EXISTS "uuid-ossp";`,
-		`CREATE EXTENSION IF NOT EXISTS postgis;`,
-	}
-	for _, ext := range extensions {
-		if _, err := db.Exec(ext); err != nil {
-			logrus.Fatalf("Error creating extension: %v", err)
-		}
-	}
-
 	// Set logging for better insights
 	dbSettings := []string{
 		fmt.Sprintf(`ALTER DATABASE %s SET log_statement = 'all';`, dbName),
@@ -45,7 +34,7 @@ func createDatabase(db *sql.DB) {
 		}
 	}
 
-	logrus.Info("Database extensions and settings applied")
+	logrus.Info("Database settings applied")
 }
 
 // insertRestaurants inserts random restaurant data into the database.
@@ -63,20 +52,43 @@ func insertRestaurants(count int, stdout bool, db *sql.DB) {
 		capacityJSON, _ := json.Marshal(capacity)
 		endorsJSON, _ := json.Marshal(endors)
 
-		openingTime, closingTime := randomBusinessHours()
+		turnTime := randomTurnTime()
 
 		sqlStmt := `
-			INSERT INTO restaurants (name, capacity, endorsements, location, opening_time, closing_time)
-			VALUES ($1, $2::jsonb, $3::jsonb, ST_SetSRID(ST_MakePoint($4, $5), 4326), $6, $7)
+			INSERT INTO restaurants (name, capacity, endorsements, location, turn_time)
+			VALUES ($1, $2::jsonb, $3::jsonb, ST_SetSRID(ST_MakePoint($4, $5), 4326), $6::interval)
 			RETURNING id;`
 
 		if stdout {
 			logrus.Infof("Would execute: %s", sqlStmt)
 		} else {
 			var id string
-			if err := db.QueryRow(sqlStmt, name, string(capacityJSON), string(endorsJSON), lon, lat, openingTime, closingTime).Scan(&id); err != nil {
+			if err := db.QueryRow(sqlStmt, name, string(capacityJSON), string(endorsJSON), lon, lat, turnTime).Scan(&id); err != nil {
 				logrus.Errorf("Error inserting restaurant: %v", err)
+				continue
 			}
+			insertBusinessHours(id, db)
+		}
+	}
+}
+
+// insertBusinessHours gives a restaurant a random weekly schedule, and closes some of them for the holidays
+func insertBusinessHours(restaurantID string, db *sql.DB) {
+	for _, hours := range randomBusinessHours() {
+		_, err := db.Exec(`INSERT INTO restaurant_hours (restaurant_id, day_of_week, opens_at, closes_at) VALUES ($1, $2, $3, $4)`,
+			restaurantID, hours.dayOfWeek, hours.opensAt, hours.closesAt)
+		if err != nil {
+			logrus.Errorf("Error inserting restaurant hours: %v", err)
+		}
+	}
+
+	if rng.Float64() < 0.3 {
+		christmas := fmt.Sprintf("%d-12-25", time.Now().Year())
+		_, err := db.Exec(`INSERT INTO restaurant_hours_exceptions (restaurant_id, exception_date, reason) VALUES ($1, $2, $3)
+			ON CONFLICT DO NOTHING`,
+			restaurantID, christmas, "Closed for Christmas")
+		if err != nil {
+			logrus.Errorf("Error inserting restaurant closure: %v", err)
 		}
 	}
 }
@@ -84,11 +96,17 @@ func insertRestaurants(count int, stdout bool, db *sql.DB) {
 // insertDiners inserts a specified number of diners into the database
 func insertDiners(count int, stdout bool, db *sql.DB) {
 	for i := 0; i < count; i++ {
-		name := RandomName(rng)       // Generate a random diner name
-		lat, lon := randomLocation()  // Generate random latitude and longitude
-		prefs := randomEndorsements() // Generate random preferences
+		name := RandomName(rng)      // Generate a random diner name
+		lat, lon := randomLocation() // Generate random latitude and longitude
+		// Generate random endorsements and split them into restrictions and preferences
+		restrictions, prefs := splitRestrictions(randomEndorsements())
 
-		// Marshal preferences to JSON (since it's stored as JSONB in the database)
+		// Marshal them to JSON (since they're stored as JSONB in the database)
+		restrictionsJSON, err := json.Marshal(restrictions)
+		if err != nil {
+			logrus.Errorf("Error marshaling restrictions JSON: %v", err)
+			continue
+		}
 		prefsJSON, err := json.Marshal(prefs)
 		if err != nil {
 			logrus.Errorf("Error marshaling preferences JSON: %v", err)
@@ -97,8 +115,8 @@ func insertDiners(count int, stdout bool, db *sql.DB) {
 
 		// SQL statement to insert a diner
 		sqlStmt := `
-			INSERT INTO diners (name, preferences, location)
-			VALUES ($1, $2::jsonb, ST_SetSRID(ST_MakePoint($3, $4), 4326))
+			INSERT INTO diners (name, restrictions, preferences, location)
+			VALUES ($1, $2::jsonb, $3::jsonb, ST_SetSRID(ST_MakePoint($4, $5), 4326))
 			RETURNING id;
 		`
 
@@ -107,7 +125,7 @@ func insertDiners(count int, stdout bool, db *sql.DB) {
 			logrus.Infof("Would execute: %s", sqlStmt)
 		} else {
 			var id string
-			err := db.QueryRow(sqlStmt, name, string(prefsJSON), lon, lat).Scan(&id)
+			err := db.QueryRow(sqlStmt, name, string(restrictionsJSON), string(prefsJSON), lon, lat).Scan(&id)
 			if err != nil {
 				logrus.Errorf("Error inserting diner: %v", err)
 			}
@@ -115,15 +133,54 @@ func insertDiners(count int, stdout bool, db *sql.DB) {
 	}
 }
 
-// randomBusinessHours returns randomly selected opening and closing times for restaurants.
-func randomBusinessHours() (string, string) {
+// openingInterval is one entry in a restaurant's weekly schedule; a closing time not after the
+// opening time runs overnight into the next day
+type openingInterval struct {
+	dayOfWeek int // ISO: 1 = Monday ... 7 = Sunday
+	opensAt   string
+	closesAt  string
+}
+
+// randomBusinessHours returns a randomly selected weekly schedule for a restaurant.
+func randomBusinessHours() []openingInterval {
+	var hours []openingInterval
 	switch r := rng.Float64(); {
 	case r < 0.1: // 24-hour restaurant (10%)
-		return "00:00", "23:59"
-	case r < 0.35: // 10am to 10pm (25%)
-		return "10:00", "22:00"
-	default: // Dinner place (5:30pm to 11:30pm)
-		return "17:30", "23:30"
+		for day := 1; day <= 7; day++ {
+			hours = append(hours, openingInterval{day, "00:00", "24:00"})
+		}
+	case r < 0.35: // lunch and dinner, closed Sunday evenings (25%)
+		for day := 1; day <= 7; day++ {
+			hours = append(hours, openingInterval{day, "11:30", "14:30"})
+			if day != 7 {
+				hours = append(hours, openingInterval{day, "17:30", "22:00"})
+			}
+		}
+	case r < 0.5: // late-night spot, open until 2am at weekends (15%)
+		for day := 1; day <= 7; day++ {
+			if day == 5 || day == 6 {
+				hours = append(hours, openingInterval{day, "18:00", "02:00"})
+			} else {
+				hours = append(hours, openingInterval{day, "18:00", "23:30"})
+			}
+		}
+	default: // Dinner place (5:30pm to 11:30pm), closed Mondays
+		for day := 2; day <= 7; day++ {
+			hours = append(hours, openingInterval{day, "17:30", "23:30"})
+		}
+	}
+	return hours
+}
+
+// randomTurnTime returns how long a restaurant expects a table to be held, leaning towards two hours.
+func randomTurnTime() string {
+	switch r := rng.Float64(); {
+	case r < 0.2: // quick service (20%)
+		return "01:30"
+	case r < 0.85: // the usual two hours (65%)
+		return "02:00"
+	default: // lingering tasting menus (15%)
+		return "02:30"
 	}
 }
 
@@ -131,7 +188,8 @@ func randomBusinessHours() (string, string) {
 func main() {
 	stdout := flag.Bool("stdout", false, "Print SQL statements to stdout instead of executing")
 	initdb := flag.Bool("initdb", false, "Initialize the database with test data")
-	configFile := flag.String("config", "/config/config.json", "Path to the config file")
+	configFlags := core.RegisterConfigFlags(flag.CommandLine, "/config/config.json")
+	sqlDir := flag.String("sql-dir", "", "Read SQL from this directory instead of the copy built into the binary")
 	properName := flag.Bool("proper-name", false, "Generate a random proper name")
 	restaurantName := flag.Bool("restaurant-name", false, "Generate a random restaurant name")
 	flag.Parse()
@@ -140,6 +198,10 @@ func main() {
 	logrus.SetFormatter(&logrus.TextFormatter{FullTimestamp: true})
 	logrus.SetLevel(logrus.InfoLevel)
 
+	if *sqlDir != "" {
+		core.SetSQLDir(*sqlDir)
+	}
+
 	if *properName {
 		fmt.Println(RandomName(rng))
 		return
@@ -150,10 +212,11 @@ func main() {
 	}
 
 	// Load configuration
-	config, err := core.LoadConfig(*configFile)
+	config, err := configFlags.Load()
 	if err != nil {
 		logrus.Fatalf("Error loading config: %v", err)
 	}
+	logrus.SetLevel(config.LogLevel())
 
 	// Connect to the database
 	db, err := core.ConnectDB(config)
@@ -19,17 +19,28 @@ var (
 	fineDiningPlaceDescriptors = []string{"on 32nd", "Compromise", "Watering Hole", "Gastronomy", "Transcendence", "Retreat"}
 	frenchPhrases              = []string{"Le Rêve", "Maison", "Cuisine", "Gourmand", "Savoureux"}
 	italianPhrases             = []string{"La Vita", "Il Gusto", "Osteria", "Bontà"}
-	endorsementWeights         = map[string]float64{
+	// endorsementWeights keys must all be in the endorsements table (04_endorsements.sql), which
+	// rejects anything else
+	endorsementWeights = map[string]float64{
 		"gluten-free":          0.15,
 		"kid-friendly":         0.15,
 		"paleo":                0.05,
 		"vegan":                0.05,
+		"vegetarian":           0.10,
 		"organic":              0.20,
 		"halal":                0.10,
 		"kosher":               0.05,
 		"pet-friendly":         0.15,
 		"molecular-gastronomy": 0.05,
 	}
+	// dietaryRestrictions are the endorsements a diner cannot do without; the rest are preferences
+	dietaryRestrictions = map[string]bool{
+		"gluten-free": true,
+		"vegan":       true,
+		"vegetarian":  true,
+		"halal":       true,
+		"kosher":      true,
+	}
 )
 
 // RandomName generates a random name using the provided random number generator
@@ -112,3 +123,23 @@ func randomEndorsements() []string {
 
 	return selected
 }
+
+// splitRestrictions separates a diner's endorsements into hard dietary restrictions and soft
+// preferences, dropping any duplicates picked by randomEndorsements.
+func splitRestrictions(endorsements []string) ([]string, []string) {
+	restrictions := make([]string, 0)
+	preferences := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, endorsement := range endorsements {
+		if seen[endorsement] {
+			continue
+		}
+		seen[endorsement] = true
+		if dietaryRestrictions[endorsement] {
+			restrictions = append(restrictions, endorsement)
+		} else {
+			preferences = append(preferences, endorsement)
+		}
+	}
+	return restrictions, preferences
+}
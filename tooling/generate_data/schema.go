@@ -1,17 +1,14 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"github.com/janearc/bourdain/core"
 	"github.com/sirupsen/logrus"
-	"os"
-	"path/filepath"
-	"sort"
-	"strconv"
-	"strings"
 )
 
-// buildSchema builds the schema from static SQL files to keep that out of the Golang code
+// buildSchema brings the schema up to date by applying any pending migrations from the static SQL files,
+// which keeps that out of the Golang code
 func buildSchema(db *sql.DB) {
 	remoteDB, err := core.GetCurrentDatabase(db)
 	if err != nil {
@@ -20,43 +17,18 @@ func buildSchema(db *sql.DB) {
 		logrus.Infof("[buildschema] Current database: %s", remoteDB)
 	}
 
-	// Define the path to the SQL directory (inside docker)
-	sqlDir := "/config/queries"
-
-	// Read all the files from the SQL directory
-	files, err := os.ReadDir(sqlDir)
+	// The SQL is embedded in the binary unless --sql-dir points somewhere else
+	migrations, err := core.LoadMigrations(core.SQLFS())
 	if err != nil {
-		logrus.Fatalf("Error reading directory: %v", err)
-	}
-
-	// Filter for SQL files
-	var sqlFiles []os.DirEntry
-	for _, file := range files {
-		if filepath.Ext(file.Name()) == ".sql" {
-			sqlFiles = append(sqlFiles, file)
-		}
+		logrus.Fatalf("Error loading migrations: %v", err)
 	}
 
-	// Sort the files numerically based on their prefix
-	sort.Slice(sqlFiles, func(i, j int) bool {
-		num1 := extractFilePrefix(sqlFiles[i].Name())
-		num2 := extractFilePrefix(sqlFiles[j].Name())
-		return num1 < num2
-	})
-
-	// Iterate over each sorted file and execute them
-	for _, file := range sqlFiles {
-		sqlFilePath := filepath.Join(sqlDir, file.Name())
-
-		// Execute each SQL file normally for schema creation
-		_, err := core.ExecSQLFromFile(db, sqlFilePath)
-		if err != nil {
-			logrus.Fatalf("Error executing SQL file %s: %v", file.Name(), err)
-		}
-		logrus.Infof("Successfully executed SQL file: %s", file.Name())
+	applied, err := core.NewMigrator(db, migrations).Up(context.Background())
+	if err != nil {
+		logrus.Fatalf("Error migrating schema: %v", err)
 	}
 
-	logrus.Info("All SQL entities created.")
+	logrus.Infof("All SQL entities created (%d migrations applied).", applied)
 }
 
 // runPopulateTops runs the populate_tops function after schema creation
@@ -84,14 +56,3 @@ func runPopulateTops(db *sql.DB) error {
 	logrus.Info("Tops populated successfully after schema creation.")
 	return nil
 }
-
-// extractFilePrefix extracts the numeric prefix from a file name (e.g., "00_restaurants.sql" -> 0)
-func extractFilePrefix(fileName string) int {
-	parts := strings.Split(fileName, "_")
-	if len(parts) > 0 {
-		if num, err := strconv.Atoi(parts[0]); err == nil {
-			return num
-		}
-	}
-	return 0 // Default to 0 if no prefix found
-}
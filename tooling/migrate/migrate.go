@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/janearc/bourdain/core"
+	"github.com/sirupsen/logrus"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+)
+
+func usage() {
+	fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] up|down|status|baseline <version>\n", os.Args[0])
+	flag.PrintDefaults()
+}
+
+func main() {
+	configFlags := core.RegisterConfigFlags(flag.CommandLine, "/config/config.json")
+	sqlDir := flag.String("sql-dir", "", "Read migrations from this directory instead of the copy built into the binary")
+	steps := flag.Int("steps", 1, "Number of migrations to roll back with down")
+	flag.Usage = usage
+	flag.Parse()
+
+	// Configure Logrus
+	logrus.SetFormatter(&logrus.TextFormatter{FullTimestamp: true})
+	logrus.SetLevel(logrus.InfoLevel)
+
+	// baseline takes the version the existing schema is at; the other commands take nothing
+	command := flag.Arg(0)
+	var baselineVersion int
+	switch {
+	case flag.NArg() == 1 && (command == "up" || command == "down" || command == "status"):
+	case flag.NArg() == 2 && command == "baseline":
+		version, err := strconv.Atoi(flag.Arg(1))
+		if err != nil {
+			fmt.Fprintf(flag.CommandLine.Output(), "Invalid baseline version %q\n", flag.Arg(1))
+			os.Exit(2)
+		}
+		baselineVersion = version
+	default:
+		usage()
+		os.Exit(2)
+	}
+
+	if *sqlDir != "" {
+		core.SetSQLDir(*sqlDir)
+	}
+
+	migrations, err := core.LoadMigrations(core.SQLFS())
+	if err != nil {
+		logrus.Fatalf("Error loading migrations: %v", err)
+	}
+
+	// Load configuration
+	config, err := configFlags.Load()
+	if err != nil {
+		logrus.Fatalf("Error loading config: %v", err)
+	}
+	logrus.SetLevel(config.LogLevel())
+
+	// Connect to the database
+	db, err := core.ConnectDB(config)
+	if err != nil {
+		logrus.Fatalf("Error connecting to the database: %v", err)
+	}
+	defer db.Close()
+
+	migrator := core.NewMigrator(db, migrations)
+	ctx := context.Background()
+
+	switch command {
+	case "up":
+		applied, err := migrator.Up(ctx)
+		if err != nil {
+			logrus.Fatalf("Error migrating up: %v", err)
+		}
+		logrus.Infof("Applied %d migrations", applied)
+	case "down":
+		rolledBack, err := migrator.Down(ctx, *steps)
+		if err != nil {
+			logrus.Fatalf("Error migrating down: %v", err)
+		}
+		logrus.Infof("Rolled back %d migrations", rolledBack)
+	case "baseline":
+		recorded, err := migrator.Baseline(ctx, baselineVersion)
+		if err != nil {
+			logrus.Fatalf("Error recording baseline: %v", err)
+		}
+		logrus.Infof("Recorded %d migrations as applied", recorded)
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			logrus.Fatalf("Error reading migration status: %v", err)
+		}
+		printStatus(statuses)
+	}
+}
+
+// printStatus prints a table of migrations and when each was applied
+func printStatus(statuses []core.MigrationStatus) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tNAME\tSTATUS\tAPPLIED AT\tDOWN")
+	for _, status := range statuses {
+		state, appliedAt := "pending", "-"
+		if status.Applied {
+			state = "applied"
+			appliedAt = status.AppliedAt.UTC().Format(time.RFC3339)
+			if status.Modified {
+				state = "modified"
+			}
+		}
+		down := "yes"
+		if status.Down == "" {
+			down = "no"
+		}
+		fmt.Fprintf(w, "%02d\t%s\t%s\t%s\t%s\n", status.Version, status.Name, state, appliedAt, down)
+	}
+	w.Flush()
+}
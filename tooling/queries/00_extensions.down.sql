@@ -0,0 +1,3 @@
+DROP EXTENSION IF EXISTS btree_gist;
+DROP EXTENSION IF EXISTS postgis;
+DROP EXTENSION IF EXISTS "uuid-ossp";
@@ -0,0 +1,5 @@
+-- uuid-ossp for uuid_generate_v4, PostGIS for locations and btree_gist for the reservation_tops
+-- exclusion constraint
+CREATE EXTENSION IF NOT EXISTS "uuid-ossp";
+CREATE EXTENSION IF NOT EXISTS postgis;
+CREATE EXTENSION IF NOT EXISTS btree_gist;
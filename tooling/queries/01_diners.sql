@@ -1,9 +1,11 @@
 CREATE TABLE public.diners (
                                id uuid DEFAULT public.uuid_generate_v4() NOT NULL,
                                name character varying(255) NOT NULL,
-                               preferences jsonb NOT NULL,
+                               restrictions jsonb DEFAULT '[]'::jsonb NOT NULL, -- non-negotiable, e.g. kosher or gluten-free
+                               preferences jsonb NOT NULL, -- nice to have, e.g. organic or pet-friendly
                                location public.geography(Point,4326),
                                PRIMARY KEY (id)
 );
 
+CREATE INDEX idx_diner_restrictions ON diners USING gin (restrictions);
 CREATE INDEX idx_diner_preferences ON diners USING gin (preferences);
\ No newline at end of file
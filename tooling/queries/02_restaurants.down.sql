@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS public.restaurants;
+DROP FUNCTION IF EXISTS is_valid_time_zone(text);
@@ -1,10 +1,24 @@
+-- is_valid_time_zone reports whether tz is an IANA time zone name Postgres knows
+CREATE OR REPLACE FUNCTION is_valid_time_zone(tz text)
+    RETURNS boolean AS $$
+SELECT EXISTS (SELECT 1 FROM pg_timezone_names WHERE name = tz);
+$$ LANGUAGE sql STABLE;
+
 CREATE TABLE public.restaurants (
                                     id uuid DEFAULT public.uuid_generate_v4() NOT NULL,
                                     name character varying(255) NOT NULL,
                                     capacity jsonb NOT NULL,
                                     endorsements jsonb NOT NULL,
                                     location public.geography(Point,4326),
-                                    opening_time time without time zone NOT NULL,
-                                    closing_time time without time zone NOT NULL,
-                                    PRIMARY KEY (id)
+                                    time_zone text DEFAULT 'America/New_York' NOT NULL, -- IANA zone its opening hours are in
+                                    max_joined_tables integer DEFAULT 3 NOT NULL,
+                                    seating_strategy character varying(32) DEFAULT 'fewest_wasted_seats' NOT NULL,
+                                    turn_time interval DEFAULT '02:00:00' NOT NULL,
+                                    min_duration interval DEFAULT '00:30:00' NOT NULL,
+                                    max_duration interval DEFAULT '04:00:00' NOT NULL,
+                                    PRIMARY KEY (id),
+                                    CHECK (is_valid_time_zone(time_zone)),
+                                    CHECK (max_joined_tables > 0),
+                                    CHECK (min_duration > '0'::interval AND min_duration <= turn_time AND turn_time <= max_duration),
+                                    CHECK (seating_strategy IN ('fewest_wasted_seats', 'fewest_tables'))
 );
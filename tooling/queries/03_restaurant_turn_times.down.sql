@@ -0,0 +1,3 @@
+DROP FUNCTION IF EXISTS reservation_duration_allowed(uuid, timestamptz, timestamptz);
+DROP FUNCTION IF EXISTS reservation_turn_time(uuid, int);
+DROP TABLE IF EXISTS public.restaurant_turn_times;
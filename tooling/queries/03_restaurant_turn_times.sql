@@ -0,0 +1,49 @@
+-- Per-party-size turn times, overriding restaurants.turn_time for parties of at least min_party_size
+CREATE TABLE public.restaurant_turn_times (
+                                              restaurant_id uuid NOT NULL,
+                                              min_party_size integer NOT NULL,
+                                              turn_time interval NOT NULL,
+                                              PRIMARY KEY (restaurant_id, min_party_size),
+                                              FOREIGN KEY (restaurant_id) REFERENCES public.restaurants(id) ON DELETE CASCADE,
+                                              CHECK (min_party_size > 0),
+                                              CHECK (turn_time > '0'::interval)
+);
+
+-- reservation_turn_time returns how long a party of the given size is expected to hold its table
+CREATE OR REPLACE FUNCTION reservation_turn_time(
+    restaurant_uuid uuid, party_size int
+) RETURNS interval AS $$
+DECLARE
+    turn interval;
+BEGIN
+    -- The most specific per-party-size rule wins
+    SELECT tt.turn_time INTO turn
+    FROM restaurant_turn_times tt
+    WHERE tt.restaurant_id = restaurant_uuid
+      AND tt.min_party_size <= party_size
+    ORDER BY tt.min_party_size DESC
+    LIMIT 1;
+
+    IF turn IS NULL THEN
+        SELECT r.turn_time INTO turn
+        FROM restaurants r
+        WHERE r.id = restaurant_uuid;
+    END IF;
+
+    RETURN turn;
+END;
+$$ LANGUAGE plpgsql;
+
+-- reservation_duration_allowed reports whether the restaurant accepts reservations of this length
+CREATE OR REPLACE FUNCTION reservation_duration_allowed(
+    restaurant_uuid uuid, req_start_time timestamptz, req_end_time timestamptz
+) RETURNS boolean AS $$
+BEGIN
+    RETURN EXISTS (
+        SELECT 1
+        FROM restaurants r
+        WHERE r.id = restaurant_uuid
+          AND req_end_time - req_start_time BETWEEN r.min_duration AND r.max_duration
+    );
+END;
+$$ LANGUAGE plpgsql;
\ No newline at end of file
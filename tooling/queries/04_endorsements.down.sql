@@ -0,0 +1,7 @@
+DROP TRIGGER IF EXISTS restaurants_endorsements_valid ON public.restaurants;
+DROP TRIGGER IF EXISTS diners_endorsements_valid ON public.diners;
+DROP FUNCTION IF EXISTS check_endorsement_columns();
+DROP FUNCTION IF EXISTS validate_endorsements(jsonb);
+DROP FUNCTION IF EXISTS expand_endorsements(jsonb);
+DROP TABLE IF EXISTS public.endorsement_implications;
+DROP TABLE IF EXISTS public.endorsements;
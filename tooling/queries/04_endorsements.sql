@@ -0,0 +1,102 @@
+-- The endorsement vocabulary shared by restaurants' endorsements and diners' restrictions and preferences
+CREATE TABLE public.endorsements (
+                                     tag character varying(64) NOT NULL,
+                                     description text NOT NULL,
+                                     PRIMARY KEY (tag)
+);
+
+-- A restaurant endorsed for tag also satisfies diners asking for implies, e.g. vegan satisfies vegetarian
+CREATE TABLE public.endorsement_implications (
+                                                 tag character varying(64) NOT NULL,
+                                                 implies character varying(64) NOT NULL,
+                                                 PRIMARY KEY (tag, implies),
+                                                 FOREIGN KEY (tag) REFERENCES public.endorsements(tag) ON DELETE CASCADE,
+                                                 FOREIGN KEY (implies) REFERENCES public.endorsements(tag) ON DELETE CASCADE,
+                                                 CHECK (tag <> implies)
+);
+
+INSERT INTO public.endorsements (tag, description) VALUES
+    ('gluten-free', 'Dishes can be prepared without gluten'),
+    ('dairy-free', 'Dishes can be prepared without dairy'),
+    ('shellfish-free', 'No shellfish in the kitchen'),
+    ('pork-free', 'No pork in the kitchen'),
+    ('vegetarian', 'No meat or fish'),
+    ('vegan', 'No animal products'),
+    ('paleo', 'Paleo diet options'),
+    ('halal', 'Halal certified'),
+    ('kosher', 'Kosher certified'),
+    ('organic', 'Organic ingredients'),
+    ('kid-friendly', 'Welcoming to children'),
+    ('pet-friendly', 'Welcoming to pets'),
+    ('molecular-gastronomy', 'Experimental, science-led cooking');
+
+INSERT INTO public.endorsement_implications (tag, implies) VALUES
+    ('vegan', 'vegetarian'),
+    ('vegan', 'dairy-free'),
+    ('vegetarian', 'shellfish-free'),
+    ('vegetarian', 'pork-free'),
+    ('kosher', 'shellfish-free'),
+    ('kosher', 'pork-free'),
+    ('halal', 'pork-free');
+
+-- expand_endorsements returns the given endorsements plus everything they imply, directly or not
+CREATE OR REPLACE FUNCTION expand_endorsements(tags jsonb)
+    RETURNS jsonb AS $$
+WITH RECURSIVE offered(tag) AS (
+    SELECT jsonb_array_elements_text(COALESCE(tags, '[]'::jsonb))
+    UNION
+    SELECT i.implies::text
+    FROM public.endorsement_implications i
+             JOIN offered o ON i.tag = o.tag
+)
+SELECT COALESCE(jsonb_agg(tag ORDER BY tag), '[]'::jsonb)
+FROM offered;
+$$ LANGUAGE sql STABLE;
+
+-- validate_endorsements raises SQLSTATE BD010 with the unknown tags, comma separated, in DETAIL if
+-- any of the given endorsements are not in the vocabulary
+CREATE OR REPLACE FUNCTION validate_endorsements(tags jsonb)
+    RETURNS void AS $$
+DECLARE
+    unknown_tags text;
+BEGIN
+    IF tags IS NULL THEN
+        RETURN;
+    END IF;
+
+    IF jsonb_typeof(tags) <> 'array' THEN
+        RAISE EXCEPTION 'Endorsements must be a JSON array.'
+            USING ERRCODE = 'invalid_parameter_value';
+    END IF;
+
+    SELECT string_agg(DISTINCT t, ',' ORDER BY t) INTO unknown_tags
+    FROM jsonb_array_elements_text(tags) AS t
+    WHERE NOT EXISTS (SELECT 1 FROM public.endorsements e WHERE e.tag = t);
+
+    IF unknown_tags IS NOT NULL THEN
+        RAISE EXCEPTION 'Unknown endorsements: %.', unknown_tags
+            USING ERRCODE = 'BD010', DETAIL = unknown_tags;
+    END IF;
+END;
+$$ LANGUAGE plpgsql STABLE;
+
+-- check_endorsement_columns is a row trigger validating each jsonb column named in its arguments
+CREATE OR REPLACE FUNCTION check_endorsement_columns()
+    RETURNS trigger AS $$
+DECLARE
+    row_data jsonb := to_jsonb(NEW);
+BEGIN
+    FOR i IN 0..TG_NARGS - 1 LOOP
+            PERFORM validate_endorsements(row_data -> TG_ARGV[i]);
+        END LOOP;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER diners_endorsements_valid
+    BEFORE INSERT OR UPDATE OF restrictions, preferences ON public.diners
+    FOR EACH ROW EXECUTE FUNCTION check_endorsement_columns('restrictions', 'preferences');
+
+CREATE TRIGGER restaurants_endorsements_valid
+    BEFORE INSERT OR UPDATE OF endorsements ON public.restaurants
+    FOR EACH ROW EXECUTE FUNCTION check_endorsement_columns('endorsements');
@@ -1,9 +1,22 @@
 CREATE TABLE public.reservations (
                                      id uuid DEFAULT public.uuid_generate_v4() NOT NULL,
                                      restaurant_id uuid NOT NULL,
-                                     start_time timestamp without time zone NOT NULL,
-                                     end_time timestamp without time zone NOT NULL,
+                                     start_time timestamp with time zone NOT NULL,
+                                     end_time timestamp with time zone NOT NULL,
                                      num_diners integer NOT NULL,
+                                     num_guests integer DEFAULT 0 NOT NULL,
+                                     guest_restrictions jsonb DEFAULT '[]'::jsonb NOT NULL,
+                                     guest_preferences jsonb DEFAULT '[]'::jsonb NOT NULL,
+                                     notes text,
+                                     status character varying(32) DEFAULT 'confirmed' NOT NULL,
+                                     created_at timestamp with time zone DEFAULT now() NOT NULL,
+                                     cancelled_at timestamp with time zone,
+                                     cancelled_by character varying(255),
                                      PRIMARY KEY (id),
-                                     FOREIGN KEY (restaurant_id) REFERENCES public.restaurants(id) ON DELETE CASCADE
-);
\ No newline at end of file
+                                     FOREIGN KEY (restaurant_id) REFERENCES public.restaurants(id) ON DELETE CASCADE,
+                                     CHECK (status IN ('confirmed', 'cancelled'))
+);
+
+CREATE TRIGGER reservations_endorsements_valid
+    BEFORE INSERT OR UPDATE OF guest_restrictions, guest_preferences ON public.reservations
+    FOR EACH ROW EXECUTE FUNCTION check_endorsement_columns('guest_restrictions', 'guest_preferences');
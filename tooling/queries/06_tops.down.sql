@@ -0,0 +1,2 @@
+DROP FUNCTION IF EXISTS populate_tops();
+DROP TABLE IF EXISTS public.tops;
@@ -2,13 +2,12 @@ CREATE TABLE public.tops (
                              id uuid DEFAULT public.uuid_generate_v4() NOT NULL,
                              restaurant_id uuid NOT NULL,
                              table_size integer NOT NULL,
-                             occupied boolean DEFAULT false NOT NULL,
-                             reservation_id uuid,
                              PRIMARY KEY (id),
-                             FOREIGN KEY (restaurant_id) REFERENCES public.restaurants(id) ON DELETE CASCADE,
-                             FOREIGN KEY (reservation_id) REFERENCES public.reservations(id) ON DELETE SET NULL
+                             FOREIGN KEY (restaurant_id) REFERENCES public.restaurants(id) ON DELETE CASCADE
 );
 
+CREATE INDEX idx_tops_restaurant ON tops(restaurant_id);
+
 CREATE OR REPLACE FUNCTION populate_tops() RETURNS void AS $$
 DECLARE
     restaurant RECORD;
@@ -33,8 +32,8 @@ BEGIN
             -- Insert two-top tables
             IF num_two_top > 0 THEN
                 FOR _ IN 1..num_two_top LOOP
-                        INSERT INTO tops (restaurant_id, table_size, occupied)
-                        VALUES (restaurant.id, 2, false);
+                        INSERT INTO tops (restaurant_id, table_size)
+                        VALUES (restaurant.id, 2);
                         RAISE NOTICE 'Inserted two-top for restaurant: %', restaurant.id;
                     END LOOP;
             END IF;
@@ -42,8 +41,8 @@ BEGIN
             -- Insert four-top tables
             IF num_four_top > 0 THEN
                 FOR _ IN 1..num_four_top LOOP
-                        INSERT INTO tops (restaurant_id, table_size, occupied)
-                        VALUES (restaurant.id, 4, false);
+                        INSERT INTO tops (restaurant_id, table_size)
+                        VALUES (restaurant.id, 4);
                         RAISE NOTICE 'Inserted four-top for restaurant: %', restaurant.id;
                     END LOOP;
             END IF;
@@ -51,8 +50,8 @@ BEGIN
             -- Insert six-top tables
             IF num_six_top > 0 THEN
                 FOR _ IN 1..num_six_top LOOP
-                        INSERT INTO tops (restaurant_id, table_size, occupied)
-                        VALUES (restaurant.id, 6, false);
+                        INSERT INTO tops (restaurant_id, table_size)
+                        VALUES (restaurant.id, 6);
                         RAISE NOTICE 'Inserted six-top for restaurant: %', restaurant.id;
                     END LOOP;
             END IF;
@@ -61,21 +60,3 @@ BEGIN
     RAISE NOTICE 'Finished populating tops for all restaurants.';
 END;
 $$ LANGUAGE plpgsql;
-
--- get_available_tops function to find available tables
-CREATE OR REPLACE FUNCTION get_available_tops(
-    restaurant_uuid uuid, req_start_time timestamp, req_end_time timestamp
-) RETURNS TABLE(table_id uuid, table_size int) AS $$
-BEGIN
-    RETURN QUERY
-        SELECT t.id, t.table_size
-        FROM tops t
-        WHERE t.restaurant_id = restaurant_uuid
-          AND NOT EXISTS (
-            SELECT 1
-            FROM reservations res
-            WHERE res.id = t.reservation_id  -- Check if the table is reserved
-              AND (res.start_time, res.end_time) OVERLAPS (req_start_time, req_end_time)  -- Time overlap check
-        );
-END;
-$$ LANGUAGE plpgsql;
\ No newline at end of file
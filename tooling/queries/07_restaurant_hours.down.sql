@@ -0,0 +1,4 @@
+DROP FUNCTION IF EXISTS restaurant_is_open(uuid, timestamptz, timestamptz);
+DROP FUNCTION IF EXISTS restaurant_open_intervals(uuid, date, date);
+DROP TABLE IF EXISTS public.restaurant_hours_exceptions;
+DROP TABLE IF EXISTS public.restaurant_hours;
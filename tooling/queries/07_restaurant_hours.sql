@@ -0,0 +1,99 @@
+-- Weekly opening hours, in the restaurant's local time. A restaurant may open several times a day
+-- (lunch and dinner, say). When
+-- closes_at is not after opens_at the interval runs overnight, closing on the following day; a
+-- restaurant open around the clock opens at 00:00 and closes at 24:00 every day.
+CREATE TABLE public.restaurant_hours (
+                                         restaurant_id uuid NOT NULL,
+                                         day_of_week smallint NOT NULL, -- ISO day of the week the interval opens: 1 = Monday ... 7 = Sunday
+                                         opens_at time without time zone NOT NULL,
+                                         closes_at time without time zone NOT NULL,
+                                         PRIMARY KEY (restaurant_id, day_of_week, opens_at),
+                                         FOREIGN KEY (restaurant_id) REFERENCES public.restaurants(id) ON DELETE CASCADE,
+                                         CHECK (day_of_week BETWEEN 1 AND 7)
+);
+
+-- Dated exceptions to the weekly hours, such as holidays or private events. Any exception on a date
+-- replaces that day's weekly hours entirely: a row without times closes the restaurant all day,
+-- while rows with times give the only intervals it opens that day.
+CREATE TABLE public.restaurant_hours_exceptions (
+                                                    id uuid DEFAULT public.uuid_generate_v4() NOT NULL,
+                                                    restaurant_id uuid NOT NULL,
+                                                    exception_date date NOT NULL,
+                                                    opens_at time without time zone,
+                                                    closes_at time without time zone,
+                                                    reason text,
+                                                    PRIMARY KEY (id),
+                                                    FOREIGN KEY (restaurant_id) REFERENCES public.restaurants(id) ON DELETE CASCADE,
+                                                    CHECK ((opens_at IS NULL) = (closes_at IS NULL))
+);
+
+CREATE INDEX idx_restaurant_hours_exceptions_date ON restaurant_hours_exceptions(restaurant_id, exception_date);
+
+-- restaurant_open_intervals lists when the restaurant is open for intervals that open on any local
+-- day from first_day to last_day, applying dated exceptions in place of the weekly hours. Local
+-- opening times are turned into instants in the restaurant's time zone, so they follow DST changes.
+CREATE OR REPLACE FUNCTION restaurant_open_intervals(
+    restaurant_uuid uuid, first_day date, last_day date
+) RETURNS TABLE(opens timestamptz, closes timestamptz) AS $$
+DECLARE
+    tz text;
+BEGIN
+    SELECT r.time_zone INTO tz
+    FROM restaurants r
+    WHERE r.id = restaurant_uuid;
+
+    RETURN QUERY
+        WITH days AS (
+            SELECT first_day + n AS day
+            FROM generate_series(0, last_day - first_day) AS n
+        ),
+             day_hours AS (
+                 -- Dates with exceptions use only the exception's intervals, if any
+                 SELECT days.day, ex.opens_at, ex.closes_at
+                 FROM days
+                          JOIN restaurant_hours_exceptions ex
+                               ON ex.restaurant_id = restaurant_uuid
+                                   AND ex.exception_date = days.day
+                 WHERE ex.opens_at IS NOT NULL
+                 UNION ALL
+                 SELECT days.day, h.opens_at, h.closes_at
+                 FROM days
+                          JOIN restaurant_hours h
+                               ON h.restaurant_id = restaurant_uuid
+                                   AND h.day_of_week = extract(isodow FROM days.day)
+                 WHERE NOT EXISTS (
+                     SELECT 1
+                     FROM restaurant_hours_exceptions ex
+                     WHERE ex.restaurant_id = restaurant_uuid
+                       AND ex.exception_date = days.day
+                 )
+             )
+        SELECT (dh.day + dh.opens_at) AT TIME ZONE tz,
+               CASE WHEN dh.closes_at > dh.opens_at THEN (dh.day + dh.closes_at) AT TIME ZONE tz
+                    ELSE (dh.day + 1 + dh.closes_at) AT TIME ZONE tz END
+        FROM day_hours dh;
+END;
+$$ LANGUAGE plpgsql STABLE;
+
+-- restaurant_is_open reports whether the restaurant is open for the whole of the window. Back to back
+-- intervals count as one, so a reservation may run past midnight at a restaurant open around the
+-- clock or overnight.
+CREATE OR REPLACE FUNCTION restaurant_is_open(
+    restaurant_uuid uuid, req_start_time timestamptz, req_end_time timestamptz
+) RETURNS boolean AS $$
+DECLARE
+    tz text;
+    open_hours tstzmultirange;
+BEGIN
+    SELECT r.time_zone INTO tz
+    FROM restaurants r
+    WHERE r.id = restaurant_uuid;
+
+    -- Overnight intervals that open the (local) day before the window can still cover it
+    SELECT range_agg(tstzrange(i.opens, i.closes)) INTO open_hours
+    FROM restaurant_open_intervals(restaurant_uuid, (req_start_time AT TIME ZONE tz)::date - 1,
+                                   (req_end_time AT TIME ZONE tz)::date) AS i;
+
+    RETURN COALESCE(open_hours @> tstzrange(req_start_time, req_end_time), false);
+END;
+$$ LANGUAGE plpgsql STABLE;
@@ -0,0 +1,2 @@
+DROP FUNCTION IF EXISTS get_available_tops(uuid, timestamptz, timestamptz);
+DROP TABLE IF EXISTS public.reservation_tops;
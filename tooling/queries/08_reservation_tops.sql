@@ -0,0 +1,40 @@
+-- Create a junction table to link reservations to the specific tables (tops) they hold.
+-- Each row carries the reservation window so that a top is only "occupied" for the
+-- time it is actually booked, rather than forever.
+CREATE TABLE public.reservation_tops (
+                                         reservation_id uuid NOT NULL,
+                                         top_id uuid NOT NULL,
+                                         restaurant_id uuid NOT NULL,
+                                         start_time timestamp with time zone NOT NULL,
+                                         end_time timestamp with time zone NOT NULL,
+                                         during tstzrange GENERATED ALWAYS AS (tstzrange(start_time, end_time)) STORED,
+                                         PRIMARY KEY (reservation_id, top_id),
+                                         FOREIGN KEY (reservation_id) REFERENCES public.reservations(id) ON DELETE CASCADE,
+                                         FOREIGN KEY (top_id) REFERENCES public.tops(id) ON DELETE CASCADE,
+                                         FOREIGN KEY (restaurant_id) REFERENCES public.restaurants(id) ON DELETE CASCADE,
+                                         CHECK (end_time > start_time),
+                                         -- A top can never be held by two reservations whose windows overlap, no matter
+                                         -- how many bookings race for it. Needs btree_gist for the uuid equality.
+                                         CONSTRAINT reservation_tops_no_overlap EXCLUDE USING gist (top_id WITH =, during WITH &&)
+);
+
+-- Index for "which tops are booked at this restaurant during this window" lookups
+CREATE INDEX idx_reservation_tops_restaurant_window ON reservation_tops(restaurant_id, start_time, end_time);
+
+-- get_available_tops function to find tables that are free for the whole requested window
+CREATE OR REPLACE FUNCTION get_available_tops(
+    restaurant_uuid uuid, req_start_time timestamptz, req_end_time timestamptz
+) RETURNS TABLE(table_id uuid, table_size int) AS $$
+BEGIN
+    RETURN QUERY
+        SELECT t.id, t.table_size
+        FROM tops t
+        WHERE t.restaurant_id = restaurant_uuid
+          AND NOT EXISTS (
+            SELECT 1
+            FROM reservation_tops rt
+            WHERE rt.top_id = t.id  -- Check if this specific table is reserved
+              AND rt.during && tstzrange(req_start_time, req_end_time)  -- Time overlap check (uses the exclusion constraint's index)
+        );
+END;
+$$ LANGUAGE plpgsql;
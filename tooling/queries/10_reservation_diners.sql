@@ -5,4 +5,7 @@ CREATE TABLE public.reservation_diners (
                                            PRIMARY KEY (reservation_id, diner_id),
                                            FOREIGN KEY (reservation_id) REFERENCES public.reservations(id) ON DELETE CASCADE,
                                            FOREIGN KEY (diner_id) REFERENCES public.diners(id) ON DELETE CASCADE
-);
\ No newline at end of file
+);
+
+-- Index for "what reservations does this diner hold" lookups
+CREATE INDEX idx_reservation_diners_diner ON reservation_diners(diner_id);
\ No newline at end of file
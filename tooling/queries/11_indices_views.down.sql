@@ -0,0 +1,5 @@
+DROP MATERIALIZED VIEW IF EXISTS restaurant_endorsements;
+DROP INDEX IF EXISTS idx_diners_location;
+DROP INDEX IF EXISTS idx_restaurants_location;
+DROP INDEX IF EXISTS idx_restaurants_capacity;
+DROP INDEX IF EXISTS idx_restaurants_endorsements;
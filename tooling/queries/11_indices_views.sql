@@ -6,8 +6,9 @@ CREATE INDEX idx_restaurants_capacity ON restaurants((cast(capacity->>'two-top'
                                                      (cast(capacity->>'four-top' as integer)),
                                                      (cast(capacity->>'six-top' as integer)));
 
--- Index on opening and closing times
-CREATE INDEX idx_restaurants_times ON restaurants(opening_time, closing_time);
+-- Spatial indexes for proximity searches
+CREATE INDEX idx_restaurants_location ON restaurants USING gist(location);
+CREATE INDEX idx_diners_location ON diners USING gist(location);
 
 -- Create a materialized view to aggregate restaurant endorsements
 CREATE MATERIALIZED VIEW restaurant_endorsements AS
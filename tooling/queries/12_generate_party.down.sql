@@ -0,0 +1 @@
+DROP FUNCTION IF EXISTS generate_party(int);
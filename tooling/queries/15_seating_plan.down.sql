@@ -0,0 +1 @@
+DROP FUNCTION IF EXISTS plan_seating(uuid, int, timestamptz, timestamptz);
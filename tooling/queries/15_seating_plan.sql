@@ -0,0 +1,50 @@
+-- plan_seating works out which table sizes to join to seat a party at a restaurant during a window.
+-- It considers every combination of free tables up to the restaurant's max_joined_tables and picks
+-- the one that best fits according to its seating_strategy:
+--   fewest_wasted_seats: least empty seats, then fewest tables
+--   fewest_tables:       fewest tables, then least empty seats
+-- Returns the table sizes to use (e.g. {2,4}), or NULL if the party cannot be seated sensibly.
+CREATE OR REPLACE FUNCTION plan_seating(
+    restaurant_uuid uuid, party_size int, req_start_time timestamptz, req_end_time timestamptz
+) RETURNS int[] AS $$
+DECLARE
+    max_tables int;
+    strategy text;
+    plan int[];
+BEGIN
+    SELECT r.max_joined_tables, r.seating_strategy
+    INTO max_tables, strategy
+    FROM restaurants r
+    WHERE r.id = restaurant_uuid;
+
+    IF NOT FOUND OR party_size <= 0 THEN
+        RETURN NULL;
+    END IF;
+
+    WITH RECURSIVE free AS (
+        SELECT t.table_size, count(*) AS available
+        FROM get_available_tops(restaurant_uuid, req_start_time, req_end_time) t
+        GROUP BY t.table_size
+    ), combos(sizes, seats, tables, last_size) AS (
+        SELECT ARRAY[]::int[], 0, 0, 0
+        UNION ALL
+        -- Only ever add tables in non-decreasing size so each combination is generated once,
+        -- and stop growing a combination as soon as it seats the party
+        SELECT c.sizes || f.table_size, c.seats + f.table_size, c.tables + 1, f.table_size
+        FROM combos c
+                 JOIN free f ON f.table_size >= c.last_size
+        WHERE c.seats < party_size
+          AND c.tables < max_tables
+          AND cardinality(array_positions(c.sizes, f.table_size)) < f.available
+    )
+    SELECT c.sizes
+    INTO plan
+    FROM combos c
+    WHERE c.seats >= party_size
+    ORDER BY CASE WHEN strategy = 'fewest_tables' THEN c.tables ELSE c.seats - party_size END,
+             CASE WHEN strategy = 'fewest_tables' THEN c.seats - party_size ELSE c.tables END
+    LIMIT 1;
+
+    RETURN plan;
+END;
+$$ LANGUAGE plpgsql;
@@ -0,0 +1 @@
+DROP FUNCTION IF EXISTS find_available_restaurants(jsonb);
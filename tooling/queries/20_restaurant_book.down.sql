@@ -0,0 +1,3 @@
+DROP FUNCTION IF EXISTS public.restaurant_book(uuid, uuid[], timestamptz, timestamptz, text, int, jsonb, jsonb);
+DROP FUNCTION IF EXISTS public.check_diner_conflicts(uuid[], timestamptz, timestamptz, uuid);
+DROP FUNCTION IF EXISTS public.select_tops_for_party(uuid, int, timestamptz, timestamptz);
@@ -1,19 +1,18 @@
-CREATE OR REPLACE FUNCTION public.restaurant_book(
+-- select_tops_for_party picks tables at the restaurant that are free for the whole requested
+-- window and together seat the party following plan_seating, raising if the restaurant cannot do so
+CREATE OR REPLACE FUNCTION public.select_tops_for_party(
     restaurant_uuid uuid,
-    diner_uuids uuid[],
-    req_start_time timestamp without time zone,
-    req_end_time timestamp without time zone
-) RETURNS uuid
+    party_size int,
+    req_start_time timestamp with time zone,
+    req_end_time timestamp with time zone
+) RETURNS uuid[]
     LANGUAGE plpgsql
 AS $$
 DECLARE
-    reservation_uuid uuid;
     total_seating_capacity integer;
-    party_size int;
-    available_table_size int;
-    available_tables RECORD;
-    selected_tables uuid[];
-    total_selected_capacity int := 0;
+    plan int[];
+    planned RECORD;
+    selected_tables uuid[] := '{}';
 BEGIN
     -- Calculate the total seating capacity of the restaurant
     SELECT
@@ -24,55 +23,138 @@ BEGIN
     FROM public.restaurants
     WHERE id = restaurant_uuid;
 
-    -- Calculate the party size
-    party_size := array_length(diner_uuids, 1);
-
     -- Ensure the party size doesn't exceed the seating capacity
     IF party_size > total_seating_capacity THEN
-        RAISE EXCEPTION 'Party size exceeds the seating capacity of the restaurant.';
+        RAISE EXCEPTION 'Party size exceeds the seating capacity of the restaurant.'
+            USING ERRCODE = 'BD002';
+    END IF;
+
+    -- Work out the best combination of free table sizes for the party
+    plan := public.plan_seating(restaurant_uuid, party_size, req_start_time, req_end_time);
+
+    -- If we don't have enough tables, raise an exception
+    IF plan IS NULL THEN
+        RAISE EXCEPTION 'Not enough available tables to seat the party.'
+            USING ERRCODE = 'BD003';
     END IF;
 
-    -- Find available tables for the restaurant within the requested time frame
-    FOR available_tables IN
-        SELECT t.id, t.table_size
-        FROM public.tops t
-        WHERE t.restaurant_id = restaurant_uuid
-          AND t.occupied = false
-          AND NOT EXISTS (
-            SELECT 1
-            FROM public.reservations res
-            WHERE res.restaurant_id = t.restaurant_id
-              AND (res.start_time, res.end_time) OVERLAPS (req_start_time, req_end_time)
-        )
+    -- Pick that many free tables of each size
+    FOR planned IN
+        SELECT p.table_size, count(*)::int AS wanted
+        FROM unnest(plan) AS p(table_size)
+        GROUP BY p.table_size
         LOOP
-            -- Add the available table to the selected tables array
-            selected_tables := array_append(selected_tables, available_tables.id);
-            total_selected_capacity := total_selected_capacity + available_tables.table_size;
-
-            -- If the selected tables' capacity is enough to seat the party, stop
-            IF total_selected_capacity >= party_size THEN
-                EXIT;
-            END IF;
+            selected_tables := selected_tables || ARRAY(
+                SELECT t.table_id
+                FROM public.get_available_tops(restaurant_uuid, req_start_time, req_end_time) t
+                WHERE t.table_size = planned.table_size
+                LIMIT planned.wanted
+            );
         END LOOP;
 
-    -- If we don't have enough tables, raise an exception
-    IF total_selected_capacity < party_size THEN
-        RAISE EXCEPTION 'Not enough available tables to seat the party.';
+    RETURN selected_tables;
+END;
+$$;
+
+-- check_diner_conflicts makes sure no diner in the party already holds a reservation overlapping the
+-- requested window, raising SQLSTATE BD001 with the conflicting reservation ID in DETAIL if one does.
+-- The diner rows are locked so two bookings for the same diner cannot both pass the check.
+CREATE OR REPLACE FUNCTION public.check_diner_conflicts(
+    diner_uuids uuid[],
+    req_start_time timestamp with time zone,
+    req_end_time timestamp with time zone,
+    ignore_reservation_uuid uuid
+) RETURNS void
+    LANGUAGE plpgsql
+AS $$
+DECLARE
+    conflict RECORD;
+BEGIN
+    PERFORM 1
+    FROM public.diners d
+    WHERE d.id = ANY(diner_uuids)
+    ORDER BY d.id
+        FOR UPDATE;
+
+    SELECT rd.diner_id, res.id AS reservation_id
+    INTO conflict
+    FROM public.reservation_diners rd
+             JOIN public.reservations res ON res.id = rd.reservation_id
+    WHERE rd.diner_id = ANY(diner_uuids)
+      AND res.status = 'confirmed'
+      AND res.id IS DISTINCT FROM ignore_reservation_uuid
+      AND (res.start_time, res.end_time) OVERLAPS (req_start_time, req_end_time)
+    ORDER BY res.start_time
+    LIMIT 1;
+
+    IF FOUND THEN
+        RAISE EXCEPTION 'Diner % already has an overlapping reservation.', conflict.diner_id
+            USING ERRCODE = 'BD001', DETAIL = conflict.reservation_id::text;
+    END IF;
+END;
+$$;
+
+CREATE OR REPLACE FUNCTION public.restaurant_book(
+    restaurant_uuid uuid,
+    diner_uuids uuid[],
+    req_start_time timestamp with time zone,
+    req_end_time timestamp with time zone, -- NULL to use the restaurant's turn time for the party
+    reservation_notes text DEFAULT NULL,
+    requested_party_size int DEFAULT NULL, -- NULL when the party is exactly diner_uuids
+    guest_preferences jsonb DEFAULT NULL, -- nice-to-have tags for the anonymous guests, if any
+    guest_restrictions jsonb DEFAULT NULL -- non-negotiable dietary tags for the anonymous guests, if any
+) RETURNS uuid
+    LANGUAGE plpgsql
+AS $$
+DECLARE
+    reservation_uuid uuid;
+    party_size int;
+    selected_tables uuid[];
+BEGIN
+    -- Calculate the party size, counting anonymous guests as well as registered diners
+    party_size := public.resolve_party_size(diner_uuids, requested_party_size);
+
+    IF NOT EXISTS (SELECT 1 FROM public.restaurants r WHERE r.id = restaurant_uuid) THEN
+        RAISE EXCEPTION 'Restaurant % does not exist.', restaurant_uuid
+            USING ERRCODE = 'no_data_found';
     END IF;
 
+    -- Work out when the reservation ends if the caller left it to us
+    IF req_end_time IS NULL THEN
+        req_end_time := req_start_time + public.reservation_turn_time(restaurant_uuid, party_size);
+    END IF;
+
+    IF NOT public.reservation_duration_allowed(restaurant_uuid, req_start_time, req_end_time) THEN
+        RAISE EXCEPTION 'Reservation duration is outside the range the restaurant accepts.'
+            USING ERRCODE = 'BD009';
+    END IF;
+
+    IF NOT public.restaurant_is_open(restaurant_uuid, req_start_time, req_end_time) THEN
+        RAISE EXCEPTION 'Restaurant is not open for the requested time.'
+            USING ERRCODE = 'BD005';
+    END IF;
+
+    -- Make sure nobody in the party is already booked elsewhere at this time
+    PERFORM public.check_diner_conflicts(diner_uuids, req_start_time, req_end_time, NULL);
+
+    -- Pick tables that can seat the party for the requested window
+    selected_tables := public.select_tops_for_party(restaurant_uuid, party_size, req_start_time, req_end_time);
+
     -- Insert the new reservation
-    INSERT INTO public.reservations (restaurant_id, start_time, end_time, num_diners)
-    VALUES (restaurant_uuid, req_start_time, req_end_time, party_size)
+    INSERT INTO public.reservations (restaurant_id, start_time, end_time, num_diners, num_guests, guest_restrictions,
+                                     guest_preferences, notes)
+    VALUES (restaurant_uuid, req_start_time, req_end_time, party_size,
+            party_size - COALESCE(array_length(diner_uuids, 1), 0),
+            COALESCE(guest_restrictions, '[]'::jsonb), COALESCE(guest_preferences, '[]'::jsonb), reservation_notes)
     RETURNING id INTO reservation_uuid;
 
     -- Insert each diner into the reservation_diners table
     INSERT INTO public.reservation_diners (reservation_id, diner_id)
     SELECT reservation_uuid, unnest(diner_uuids);
 
-    -- Mark the selected tables as occupied
-    UPDATE public.tops
-    SET occupied = true, reservation_id = reservation_uuid
-    WHERE id = ANY(selected_tables);
+    -- Assign the selected tables to this reservation for the requested window only
+    INSERT INTO public.reservation_tops (reservation_id, top_id, restaurant_id, start_time, end_time)
+    SELECT reservation_uuid, unnest(selected_tables), restaurant_uuid, req_start_time, req_end_time;
 
     -- Return the reservation UUID
     RETURN reservation_uuid;
@@ -0,0 +1 @@
+DROP FUNCTION IF EXISTS public.reservation_cancel(uuid, text);
@@ -0,0 +1,47 @@
+CREATE OR REPLACE FUNCTION public.reservation_cancel(
+    reservation_uuid uuid,
+    cancelled_by_name text
+) RETURNS TABLE(reservation_id uuid, freed_tables int, freed_seats int, cancelled_at timestamptz)
+    LANGUAGE plpgsql
+AS $$
+DECLARE
+    current_status text;
+    cancel_time timestamptz := now();
+BEGIN
+    -- Lock the reservation so that concurrent cancellations serialize on it
+    SELECT res.status INTO current_status
+    FROM public.reservations res
+    WHERE res.id = reservation_uuid
+        FOR UPDATE;
+
+    IF NOT FOUND THEN
+        RAISE EXCEPTION 'Reservation % does not exist.', reservation_uuid
+            USING ERRCODE = 'no_data_found';
+    END IF;
+
+    IF current_status = 'cancelled' THEN
+        RAISE EXCEPTION 'Reservation % is already cancelled.', reservation_uuid
+            USING ERRCODE = 'object_not_in_prerequisite_state';
+    END IF;
+
+    -- Tally up what is being released before the rows go away
+    SELECT count(*)::int, coalesce(sum(t.table_size), 0)::int
+    INTO freed_tables, freed_seats
+    FROM public.reservation_tops rt
+             JOIN public.tops t ON t.id = rt.top_id
+    WHERE rt.reservation_id = reservation_uuid;
+
+    -- Release the tables and the diners
+    DELETE FROM public.reservation_tops rt WHERE rt.reservation_id = reservation_uuid;
+    DELETE FROM public.reservation_diners rd WHERE rd.reservation_id = reservation_uuid;
+
+    -- Keep the reservation itself around as a record of who cancelled and when
+    UPDATE public.reservations
+    SET status = 'cancelled', cancelled_at = cancel_time, cancelled_by = cancelled_by_name
+    WHERE id = reservation_uuid;
+
+    reservation_id := reservation_uuid;
+    cancelled_at := cancel_time;
+    RETURN NEXT;
+END;
+$$;
@@ -0,0 +1,3 @@
+DROP FUNCTION IF EXISTS public.diner_reservations(uuid, boolean);
+DROP FUNCTION IF EXISTS public.reservation_details(uuid);
+DROP VIEW IF EXISTS public.reservation_summaries;
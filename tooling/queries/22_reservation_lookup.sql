@@ -0,0 +1,63 @@
+-- reservation_summaries flattens a reservation with its restaurant, party members and assigned tables
+CREATE OR REPLACE VIEW public.reservation_summaries AS
+SELECT res.id AS reservation_id,
+       res.restaurant_id,
+       r.name::text AS restaurant_name,
+       r.time_zone AS restaurant_time_zone,
+       res.start_time,
+       res.end_time,
+       res.num_diners,
+       res.num_guests,
+       res.guest_restrictions,
+       res.guest_preferences,
+       res.status::text AS status,
+       res.notes,
+       COALESCE((
+                    SELECT jsonb_agg(jsonb_build_object('id', d.id, 'name', d.name) ORDER BY d.name)
+                    FROM public.reservation_diners rd
+                             JOIN public.diners d ON d.id = rd.diner_id
+                    WHERE rd.reservation_id = res.id
+                ), '[]'::jsonb) AS diners,
+       COALESCE((
+                    SELECT jsonb_agg(jsonb_build_object('id', t.id, 'table_size', t.table_size) ORDER BY t.table_size)
+                    FROM public.reservation_tops rt
+                             JOIN public.tops t ON t.id = rt.top_id
+                    WHERE rt.reservation_id = res.id
+                ), '[]'::jsonb) AS tables
+FROM public.reservations res
+         JOIN public.restaurants r ON r.id = res.restaurant_id;
+
+CREATE OR REPLACE FUNCTION public.reservation_details(
+    reservation_uuid uuid
+) RETURNS SETOF public.reservation_summaries
+    LANGUAGE plpgsql
+AS $$
+BEGIN
+    RETURN QUERY
+        SELECT *
+        FROM public.reservation_summaries s
+        WHERE s.reservation_id = reservation_uuid;
+END;
+$$;
+
+CREATE OR REPLACE FUNCTION public.diner_reservations(
+    diner_uuid uuid,
+    upcoming_only boolean
+) RETURNS SETOF public.reservation_summaries
+    LANGUAGE plpgsql
+AS $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM public.diners d WHERE d.id = diner_uuid) THEN
+        RAISE EXCEPTION 'Diner % does not exist.', diner_uuid
+            USING ERRCODE = 'no_data_found';
+    END IF;
+
+    RETURN QUERY
+        SELECT s.*
+        FROM public.reservation_summaries s
+                 JOIN public.reservation_diners rd ON rd.reservation_id = s.reservation_id
+        WHERE rd.diner_id = diner_uuid
+          AND (NOT upcoming_only OR s.end_time >= now())
+        ORDER BY s.start_time;
+END;
+$$;
@@ -0,0 +1 @@
+DROP FUNCTION IF EXISTS public.reservation_modify(uuid, uuid, timestamptz, timestamptz, uuid[], uuid[]);
@@ -0,0 +1,138 @@
+-- reservation_modify changes the restaurant, time window and/or party of an existing reservation.
+-- NULL arguments leave that aspect unchanged. Because the whole function runs in one transaction,
+-- any failure (no tables, restrictions not met, closed) leaves the original reservation untouched.
+CREATE OR REPLACE FUNCTION public.reservation_modify(
+    reservation_uuid uuid,
+    new_restaurant_uuid uuid,
+    new_start_time timestamp with time zone,
+    new_end_time timestamp with time zone,
+    add_diner_uuids uuid[],
+    remove_diner_uuids uuid[]
+) RETURNS uuid
+    LANGUAGE plpgsql
+AS $$
+DECLARE
+    current_reservation RECORD;
+    target_restaurant_uuid uuid;
+    target_start_time timestamptz;
+    target_end_time timestamptz;
+    target_diner_uuids uuid[];
+    party_size int;
+    party_restrictions jsonb;
+    selected_tables uuid[];
+BEGIN
+    -- Lock the reservation so that concurrent modifications and cancellations serialize on it
+    SELECT res.id, res.restaurant_id, res.start_time, res.end_time, res.status, res.num_guests, res.guest_restrictions
+    INTO current_reservation
+    FROM public.reservations res
+    WHERE res.id = reservation_uuid
+        FOR UPDATE;
+
+    IF NOT FOUND THEN
+        RAISE EXCEPTION 'Reservation % does not exist.', reservation_uuid
+            USING ERRCODE = 'no_data_found';
+    END IF;
+
+    IF current_reservation.status = 'cancelled' THEN
+        RAISE EXCEPTION 'Reservation % is cancelled and cannot be modified.', reservation_uuid
+            USING ERRCODE = 'object_not_in_prerequisite_state';
+    END IF;
+
+    -- Work out what the reservation should look like afterwards
+    target_restaurant_uuid := COALESCE(new_restaurant_uuid, current_reservation.restaurant_id);
+    target_start_time := COALESCE(new_start_time, current_reservation.start_time);
+    -- Moving the start without saying when to end keeps the reservation's current length
+    target_end_time := COALESCE(new_end_time,
+                                target_start_time + (current_reservation.end_time - current_reservation.start_time));
+
+    IF target_end_time <= target_start_time THEN
+        RAISE EXCEPTION 'Reservation must end after it starts.'
+            USING ERRCODE = 'BD006';
+    END IF;
+
+    SELECT ARRAY(
+        SELECT DISTINCT d
+        FROM (
+                 SELECT rd.diner_id AS d
+                 FROM public.reservation_diners rd
+                 WHERE rd.reservation_id = reservation_uuid
+                 UNION
+                 SELECT unnest(COALESCE(add_diner_uuids, '{}'::uuid[]))
+             ) AS party
+        WHERE d <> ALL(COALESCE(remove_diner_uuids, '{}'::uuid[]))
+    ) INTO target_diner_uuids;
+
+    -- Anonymous guests stay with the reservation whatever happens to the registered diners
+    party_size := COALESCE(array_length(target_diner_uuids, 1), 0) + current_reservation.num_guests;
+    IF party_size = 0 THEN
+        RAISE EXCEPTION 'A reservation must have at least one diner.'
+            USING ERRCODE = 'BD007';
+    END IF;
+
+    -- Re-run the restriction and opening hours checks from check_restaurant_availability. Preferences
+    -- only rank restaurants, so they never stand in the way of a modification.
+    party_restrictions := get_party_restrictions(target_diner_uuids, current_reservation.guest_restrictions);
+    IF NOT EXISTS (
+        SELECT 1
+        FROM public.restaurants r
+        WHERE r.id = target_restaurant_uuid
+    ) THEN
+        RAISE EXCEPTION 'Restaurant % does not exist.', target_restaurant_uuid
+            USING ERRCODE = 'no_data_found';
+    END IF;
+
+    IF NOT EXISTS (
+        SELECT 1
+        FROM public.restaurants r
+        WHERE r.id = target_restaurant_uuid
+          AND expand_endorsements(r.endorsements) @> party_restrictions
+    ) THEN
+        RAISE EXCEPTION 'Restaurant does not meet the dietary restrictions of the party.'
+            USING ERRCODE = 'BD004';
+    END IF;
+
+    IF NOT EXISTS (
+        SELECT 1
+        FROM public.restaurants r
+        WHERE r.id = target_restaurant_uuid
+          AND restaurant_is_open(r.id, target_start_time, target_end_time)
+    ) THEN
+        RAISE EXCEPTION 'Restaurant is not open for the requested time.'
+            USING ERRCODE = 'BD005';
+    END IF;
+
+    IF NOT public.reservation_duration_allowed(target_restaurant_uuid, target_start_time, target_end_time) THEN
+        RAISE EXCEPTION 'Reservation duration is outside the range the restaurant accepts.'
+            USING ERRCODE = 'BD009';
+    END IF;
+
+    -- Make sure nobody in the new party is already booked elsewhere at the new time
+    PERFORM public.check_diner_conflicts(target_diner_uuids, target_start_time, target_end_time, reservation_uuid);
+
+    -- Release our own tables first so the reservation can keep them if they are still free
+    DELETE FROM public.reservation_tops rt WHERE rt.reservation_id = reservation_uuid;
+
+    -- Re-run the capacity check and table selection from restaurant_book
+    selected_tables := public.select_tops_for_party(target_restaurant_uuid, party_size, target_start_time, target_end_time);
+
+    UPDATE public.reservations
+    SET restaurant_id = target_restaurant_uuid,
+        start_time = target_start_time,
+        end_time = target_end_time,
+        num_diners = party_size
+    WHERE id = reservation_uuid;
+
+    DELETE FROM public.reservation_diners rd
+    WHERE rd.reservation_id = reservation_uuid
+      AND rd.diner_id <> ALL(target_diner_uuids);
+
+    INSERT INTO public.reservation_diners (reservation_id, diner_id)
+    SELECT reservation_uuid, unnest(target_diner_uuids)
+    ON CONFLICT DO NOTHING;
+
+    INSERT INTO public.reservation_tops (reservation_id, top_id, restaurant_id, start_time, end_time)
+    SELECT reservation_uuid, unnest(selected_tables), target_restaurant_uuid, target_start_time, target_end_time;
+
+    RETURN reservation_uuid;
+END;
+$$;
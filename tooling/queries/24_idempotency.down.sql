@@ -0,0 +1,2 @@
+DROP FUNCTION IF EXISTS public.restaurant_book_idempotent(text, text, uuid, uuid[], timestamptz, timestamptz, text, int, jsonb, jsonb);
+DROP TABLE IF EXISTS public.idempotency_keys;
@@ -0,0 +1,61 @@
+-- Remember the outcome of bookings made with an Idempotency-Key so that client retries return the
+-- original reservation instead of creating a duplicate
+CREATE TABLE public.idempotency_keys (
+                                         idempotency_key character varying(255) NOT NULL,
+                                         request_hash character(64) NOT NULL,
+                                         reservation_id uuid NOT NULL,
+                                         created_at timestamp with time zone DEFAULT now() NOT NULL,
+                                         PRIMARY KEY (idempotency_key),
+                                         FOREIGN KEY (reservation_id) REFERENCES public.reservations(id) ON DELETE CASCADE
+);
+
+-- restaurant_book_idempotent books via restaurant_book unless the key has been seen before, in which
+-- case it returns the reservation created the first time. Reusing a key for a different request
+-- raises SQLSTATE BD008. Only successful bookings are remembered, so a failed attempt can be retried.
+CREATE OR REPLACE FUNCTION public.restaurant_book_idempotent(
+    request_key text,
+    payload_hash text,
+    restaurant_uuid uuid,
+    diner_uuids uuid[],
+    req_start_time timestamp with time zone,
+    req_end_time timestamp with time zone,
+    reservation_notes text DEFAULT NULL,
+    requested_party_size int DEFAULT NULL,
+    guest_preferences jsonb DEFAULT NULL,
+    guest_restrictions jsonb DEFAULT NULL
+) RETURNS TABLE(reservation_id uuid, replayed boolean)
+    LANGUAGE plpgsql
+AS $$
+DECLARE
+    existing RECORD;
+BEGIN
+    -- Serialize concurrent requests carrying the same key
+    PERFORM pg_advisory_xact_lock(hashtext(request_key));
+
+    SELECT ik.request_hash, ik.reservation_id
+    INTO existing
+    FROM public.idempotency_keys ik
+    WHERE ik.idempotency_key = request_key;
+
+    IF FOUND THEN
+        IF existing.request_hash <> payload_hash THEN
+            RAISE EXCEPTION 'Idempotency key % was already used for a different request.', request_key
+                USING ERRCODE = 'BD008';
+        END IF;
+
+        reservation_id := existing.reservation_id;
+        replayed := true;
+        RETURN NEXT;
+        RETURN;
+    END IF;
+
+    reservation_id := public.restaurant_book(restaurant_uuid, diner_uuids, req_start_time, req_end_time, reservation_notes,
+                                             requested_party_size, guest_preferences, guest_restrictions);
+    replayed := false;
+
+    INSERT INTO public.idempotency_keys (idempotency_key, request_hash, reservation_id)
+    VALUES (request_key, payload_hash, restaurant_book_idempotent.reservation_id);
+
+    RETURN NEXT;
+END;
+$$;
@@ -0,0 +1,4 @@
+DROP FUNCTION IF EXISTS public.endorsement_vocabulary();
+DROP FUNCTION IF EXISTS public.restaurant_update(uuid, text, jsonb);
+DROP FUNCTION IF EXISTS public.diner_update(uuid, text, jsonb, jsonb);
+DROP FUNCTION IF EXISTS public.diner_create(text, jsonb, jsonb, double precision, double precision);
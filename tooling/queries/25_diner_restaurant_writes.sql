@@ -0,0 +1,91 @@
+-- diner_create registers a diner. Unknown restrictions or preferences are rejected with SQLSTATE BD010
+-- by the diners_endorsements_valid trigger.
+CREATE OR REPLACE FUNCTION public.diner_create(
+    diner_name text,
+    diner_restrictions jsonb,
+    diner_preferences jsonb,
+    lat double precision, -- NULL when the diner's location is not known
+    lon double precision
+) RETURNS uuid
+    LANGUAGE plpgsql
+AS $$
+DECLARE
+    diner_uuid uuid;
+BEGIN
+    INSERT INTO public.diners (name, restrictions, preferences, location)
+    VALUES (diner_name,
+            COALESCE(diner_restrictions, '[]'::jsonb),
+            COALESCE(diner_preferences, '[]'::jsonb),
+            CASE WHEN lat IS NOT NULL AND lon IS NOT NULL
+                     THEN ST_SetSRID(ST_MakePoint(lon, lat), 4326)::geography END)
+    RETURNING id INTO diner_uuid;
+
+    RETURN diner_uuid;
+END;
+$$;
+
+-- diner_update changes a diner's name, restrictions and/or preferences; NULL arguments are left unchanged
+CREATE OR REPLACE FUNCTION public.diner_update(
+    diner_uuid uuid,
+    new_name text,
+    new_restrictions jsonb,
+    new_preferences jsonb
+) RETURNS uuid
+    LANGUAGE plpgsql
+AS $$
+BEGIN
+    UPDATE public.diners d
+    SET name = COALESCE(new_name, d.name),
+        restrictions = COALESCE(new_restrictions, d.restrictions),
+        preferences = COALESCE(new_preferences, d.preferences)
+    WHERE d.id = diner_uuid;
+
+    IF NOT FOUND THEN
+        RAISE EXCEPTION 'Diner % does not exist.', diner_uuid
+            USING ERRCODE = 'no_data_found';
+    END IF;
+
+    RETURN diner_uuid;
+END;
+$$;
+
+-- restaurant_update changes a restaurant's name and/or endorsements; NULL arguments are left unchanged
+CREATE OR REPLACE FUNCTION public.restaurant_update(
+    restaurant_uuid uuid,
+    new_name text,
+    new_endorsements jsonb
+) RETURNS uuid
+    LANGUAGE plpgsql
+AS $$
+BEGIN
+    UPDATE public.restaurants r
+    SET name = COALESCE(new_name, r.name),
+        endorsements = COALESCE(new_endorsements, r.endorsements)
+    WHERE r.id = restaurant_uuid;
+
+    IF NOT FOUND THEN
+        RAISE EXCEPTION 'Restaurant % does not exist.', restaurant_uuid
+            USING ERRCODE = 'no_data_found';
+    END IF;
+
+    RETURN restaurant_uuid;
+END;
+$$;
+
+-- endorsement_vocabulary lists every known endorsement with what it directly implies
+CREATE OR REPLACE FUNCTION public.endorsement_vocabulary()
+    RETURNS TABLE(tag text, description text, implies jsonb)
+    LANGUAGE plpgsql
+AS $$
+BEGIN
+    RETURN QUERY
+        SELECT e.tag::text, e.description,
+               COALESCE((
+                            SELECT jsonb_agg(i.implies ORDER BY i.implies)
+                            FROM public.endorsement_implications i
+                            WHERE i.tag = e.tag
+                        ), '[]'::jsonb)
+        FROM public.endorsements e
+        ORDER BY e.tag;
+END;
+$$;
@@ -0,0 +1 @@
+DROP FUNCTION IF EXISTS can_seat_party_at_time(uuid, int, timestamptz, timestamptz);
@@ -0,0 +1,13 @@
+DROP FUNCTION IF EXISTS check_restaurant_availability(uuid[], timestamptz, timestamptz, int, jsonb, double precision,
+    double precision, double precision, text, jsonb);
+DROP FUNCTION IF EXISTS predict_match_difficulty(uuid[]);
+DROP FUNCTION IF EXISTS find_available_restaurants(int, jsonb, timestamptz, timestamptz);
+DROP FUNCTION IF EXISTS attempt_match(int, jsonb, timestamptz, timestamptz);
+DROP FUNCTION IF EXISTS resolve_party_size(uuid[], int);
+DROP FUNCTION IF EXISTS calculate_party_size(uuid[]);
+DROP FUNCTION IF EXISTS endorsements_missing(jsonb, jsonb);
+DROP FUNCTION IF EXISTS endorsements_matched(jsonb, jsonb);
+DROP FUNCTION IF EXISTS get_party_centroid(uuid[]);
+DROP FUNCTION IF EXISTS get_party_restrictions(uuid[], jsonb);
+DROP FUNCTION IF EXISTS get_party_endorsements(uuid[], jsonb);
+DROP FUNCTION IF EXISTS get_endorsements_for_diners(uuid[]);
@@ -16,6 +16,79 @@ BEGIN
 END;
 $$ LANGUAGE plpgsql;
 
+-- get_party_endorsements combines the registered diners' preferences with any given for anonymous
+-- guests, always returning an array (possibly empty) so it can be used with @>
+CREATE OR REPLACE FUNCTION get_party_endorsements(
+    diner_uuids uuid[], guest_preferences jsonb
+) RETURNS jsonb AS $$
+DECLARE
+    endorsement_list jsonb;
+BEGIN
+    SELECT jsonb_agg(DISTINCT endorsement) INTO endorsement_list
+    FROM (
+             SELECT jsonb_array_elements_text(COALESCE(get_endorsements_for_diners(diner_uuids), '[]'::jsonb)) AS endorsement
+             UNION
+             SELECT jsonb_array_elements_text(COALESCE(guest_preferences, '[]'::jsonb))
+         ) AS party_endorsements;
+
+    RETURN COALESCE(endorsement_list, '[]'::jsonb);
+END;
+$$ LANGUAGE plpgsql;
+
+-- get_party_restrictions combines the registered diners' dietary restrictions with any given for
+-- anonymous guests. Unlike preferences, a restaurant must meet every one of these.
+CREATE OR REPLACE FUNCTION get_party_restrictions(
+    diner_uuids uuid[], guest_restrictions jsonb
+) RETURNS jsonb AS $$
+DECLARE
+    restriction_list jsonb;
+BEGIN
+    SELECT jsonb_agg(DISTINCT restriction) INTO restriction_list
+    FROM (
+             SELECT jsonb_array_elements_text(d.restrictions) AS restriction
+             FROM diners d
+             WHERE d.id = ANY(diner_uuids)
+             UNION
+             SELECT jsonb_array_elements_text(COALESCE(guest_restrictions, '[]'::jsonb))
+         ) AS party_restrictions;
+
+    RETURN COALESCE(restriction_list, '[]'::jsonb);
+END;
+$$ LANGUAGE plpgsql;
+
+-- get_party_centroid returns the geographic centre of the registered diners' locations, or NULL if
+-- none of them have one
+CREATE OR REPLACE FUNCTION get_party_centroid(
+    diner_uuids uuid[]
+) RETURNS geography AS $$
+DECLARE
+    centroid geography;
+BEGIN
+    SELECT ST_Centroid(ST_Collect(d.location::geometry))::geography INTO centroid
+    FROM diners d
+    WHERE d.id = ANY(diner_uuids)
+      AND d.location IS NOT NULL;
+
+    RETURN centroid;
+END;
+$$ LANGUAGE plpgsql;
+
+-- endorsements_matched returns the wanted endorsements that the restaurant offers
+CREATE OR REPLACE FUNCTION endorsements_matched(restaurant_endorsements jsonb, wanted jsonb)
+    RETURNS jsonb AS $$
+SELECT COALESCE(jsonb_agg(DISTINCT e ORDER BY e), '[]'::jsonb)
+FROM jsonb_array_elements_text(wanted) AS e
+WHERE restaurant_endorsements ? e;
+$$ LANGUAGE sql IMMUTABLE;
+
+-- endorsements_missing returns the wanted endorsements that the restaurant does not offer
+CREATE OR REPLACE FUNCTION endorsements_missing(restaurant_endorsements jsonb, wanted jsonb)
+    RETURNS jsonb AS $$
+SELECT COALESCE(jsonb_agg(DISTINCT e ORDER BY e), '[]'::jsonb)
+FROM jsonb_array_elements_text(wanted) AS e
+WHERE NOT restaurant_endorsements ? e;
+$$ LANGUAGE sql IMMUTABLE;
+
 CREATE OR REPLACE FUNCTION calculate_party_size(diner_uuids uuid[])
     RETURNS int AS $$
 BEGIN
@@ -23,30 +96,49 @@ BEGIN
 END;
 $$ LANGUAGE plpgsql;
 
+-- resolve_party_size works out the full party size from the registered diners and an optional
+-- requested size; anyone beyond the registered diners is an anonymous guest
+CREATE OR REPLACE FUNCTION resolve_party_size(diner_uuids uuid[], requested_party_size int)
+    RETURNS int AS $$
+DECLARE
+    known_diners int := COALESCE(array_length(diner_uuids, 1), 0);
+BEGIN
+    IF requested_party_size IS NULL THEN
+        requested_party_size := known_diners;
+    END IF;
+
+    IF requested_party_size < known_diners THEN
+        RAISE EXCEPTION 'Party size % is smaller than the % diners listed.', requested_party_size, known_diners
+            USING ERRCODE = 'BD007';
+    END IF;
+
+    IF requested_party_size <= 0 THEN
+        RAISE EXCEPTION 'A reservation must have at least one diner.'
+            USING ERRCODE = 'BD007';
+    END IF;
+
+    RETURN requested_party_size;
+END;
+$$ LANGUAGE plpgsql;
+
 CREATE OR REPLACE FUNCTION attempt_match(
-    party_size int, current_endorsements jsonb, req_start_time timestamp, req_end_time timestamp
+    party_size int, current_endorsements jsonb, req_start_time timestamptz, req_end_time timestamptz
 ) RETURNS TABLE(restaurant_name text, matched_endorsements jsonb, message text) AS $$
 BEGIN
     RETURN QUERY
         SELECT r.name::text, r.endorsements, 'Full match found'::text
         FROM restaurants r
         WHERE r.endorsements @> current_endorsements
-          AND r.opening_time <= req_start_time::time
-          AND r.closing_time >= req_end_time::time
+          AND restaurant_is_open(r.id, req_start_time, req_end_time)
           AND (cast(r.capacity->>'two-top' as integer) * 2) +
               (cast(r.capacity->>'four-top' as integer) * 4) +
               (cast(r.capacity->>'six-top' as integer) * 6) >= party_size
-          AND NOT EXISTS (
-            SELECT 1
-            FROM reservations res
-            WHERE res.restaurant_id = r.id
-              AND (res.start_time, res.end_time) OVERLAPS (req_start_time, req_end_time)
-        );
+          AND can_seat_party_at_time(r.id, party_size, req_start_time, req_end_time);
 END;
 $$ LANGUAGE plpgsql;
 
 CREATE OR REPLACE FUNCTION find_available_restaurants(
-    party_size int, current_endorsements jsonb, req_start_time timestamp, req_end_time timestamp
+    party_size int, current_endorsements jsonb, req_start_time timestamptz, req_end_time timestamptz
 ) RETURNS TABLE(restaurant_name text, matched_endorsements jsonb, message text) AS $$
 BEGIN
     RETURN QUERY
@@ -57,14 +149,8 @@ BEGIN
             (cast(r.capacity->>'four-top' as integer) * 4) +
             (cast(r.capacity->>'six-top' as integer) * 6) >= party_size
           AND r.endorsements @> current_endorsements
-          AND r.opening_time <= req_start_time::time
-          AND r.closing_time >= req_end_time::time
-          AND NOT EXISTS (
-            SELECT 1
-            FROM reservations res
-            WHERE res.restaurant_id = r.id
-              AND (res.start_time, res.end_time) OVERLAPS (req_start_time, req_end_time)
-        );
+          AND restaurant_is_open(r.id, req_start_time, req_end_time)
+          AND can_seat_party_at_time(r.id, party_size, req_start_time, req_end_time);
 END;
 $$ LANGUAGE plpgsql;
 
@@ -83,43 +169,81 @@ END;
 $$ LANGUAGE plpgsql;
 
 CREATE OR REPLACE FUNCTION check_restaurant_availability(
-    diner_uuids uuid[], req_start_time timestamp, req_end_time timestamp
-) RETURNS TABLE(restaurant_id uuid, restaurant_name text, matched_endorsements jsonb, message text) AS $$
+    diner_uuids uuid[], req_start_time timestamptz, req_end_time timestamptz,
+    requested_party_size int DEFAULT NULL, guest_preferences jsonb DEFAULT NULL,
+    search_lat double precision DEFAULT NULL, search_lon double precision DEFAULT NULL,
+    radius_meters double precision DEFAULT NULL,
+    match_mode text DEFAULT 'ranked', -- 'all': every preference must be met too; 'ranked': best matches first
+    guest_restrictions jsonb DEFAULT NULL
+) RETURNS TABLE(restaurant_id uuid, restaurant_name text, matched_endorsements jsonb, message text, seating_plan int[],
+                reservation_end_time timestamptz, distance_meters double precision, missing_endorsements jsonb,
+                restaurant_time_zone text) AS $$
 DECLARE
+    current_restrictions jsonb;
     current_endorsements jsonb;
+    required_endorsements jsonb;
     party_size int;
+    origin geography;
 BEGIN
-    -- Step 1: Calculate the party size
-    party_size := array_length(diner_uuids, 1);
+    -- Step 1: Calculate the party size, counting anonymous guests as well as registered diners
+    party_size := resolve_party_size(diner_uuids, requested_party_size);
+
+    -- Step 2: Get the dietary restrictions and preferences of the diners and guests. Everything the
+    -- party wants is reported as matched or missing, though only preferences can ever be missing.
+    current_restrictions := get_party_restrictions(diner_uuids, guest_restrictions);
+    current_endorsements := get_party_endorsements(diner_uuids, guest_preferences) || current_restrictions;
+    PERFORM validate_endorsements(current_endorsements);
 
-    -- Step 2: Get the endorsements of the diners
-    current_endorsements := get_endorsements_for_diners(diner_uuids);
+    -- Step 3: Check if any restaurants match the endorsements, counting everything a restaurant's own
+    -- endorsements imply (a vegan kitchen suits vegetarians). Restrictions are always required; in
+    -- ranked mode restaurants are ordered by how many preferences they meet rather than needing all.
+    IF match_mode = 'ranked' THEN
+        required_endorsements := current_restrictions;
+    ELSIF match_mode = 'all' THEN
+        required_endorsements := current_endorsements;
+    ELSE
+        RAISE EXCEPTION 'Unknown match mode %.', match_mode
+            USING ERRCODE = 'invalid_parameter_value';
+    END IF;
 
-    -- Step 3: Check if any restaurants match the endorsements
     IF NOT EXISTS (
         SELECT 1
         FROM restaurants r
-        WHERE r.endorsements @> current_endorsements
+        WHERE expand_endorsements(r.endorsements) @> required_endorsements
     ) THEN
         -- Raise an exception if no restaurants match the endorsements
-        RAISE EXCEPTION 'No restaurants match the given endorsements';
+        RAISE EXCEPTION 'No restaurants match the given endorsements'
+            USING ERRCODE = 'BD004';
+    END IF;
+
+    -- Step 4: Work out where to measure distance from: the given point, or else the middle of the party
+    IF search_lat IS NOT NULL AND search_lon IS NOT NULL THEN
+        origin := ST_SetSRID(ST_MakePoint(search_lon, search_lat), 4326)::geography;
+    ELSE
+        origin := get_party_centroid(diner_uuids);
     END IF;
 
-    -- Step 4: Proceed with normal availability check if matches are found
+    -- Step 5: Proceed with normal availability check if matches are found, only advertising
+    -- restaurants that have a sensible combination of free tables for the party. When no end
+    -- time is given, each restaurant's own turn time for the party decides when it ends.
     RETURN QUERY
-        SELECT r.id::uuid, r.name::text, r.endorsements, 'Match found'::text
-        FROM restaurants r
-        WHERE r.endorsements @> current_endorsements
-          AND r.opening_time <= req_start_time::time
-          AND r.closing_time >= req_end_time::time
+        SELECT r.id::uuid, r.name::text, e.matched,
+               CASE WHEN jsonb_array_length(e.missing) = 0 THEN 'Full match found' ELSE 'Partial match found' END,
+               p.plan, w.window_end, ST_Distance(r.location, origin), e.missing, r.time_zone
+        FROM restaurants r,
+             LATERAL (SELECT expand_endorsements(r.endorsements) AS offered) x,
+             LATERAL (SELECT endorsements_matched(x.offered, current_endorsements) AS matched,
+                             endorsements_missing(x.offered, current_endorsements) AS missing) e,
+             LATERAL (SELECT COALESCE(req_end_time, req_start_time + reservation_turn_time(r.id, party_size)) AS window_end) w,
+             LATERAL (SELECT plan_seating(r.id, party_size, req_start_time, w.window_end) AS plan) p
+        WHERE x.offered @> required_endorsements
+          AND restaurant_is_open(r.id, req_start_time, w.window_end)
+          AND w.window_end - req_start_time BETWEEN r.min_duration AND r.max_duration
           AND (cast(r.capacity->>'two-top' as integer) * 2) +
               (cast(r.capacity->>'four-top' as integer) * 4) +
               (cast(r.capacity->>'six-top' as integer) * 6) >= party_size
-          AND NOT EXISTS (
-            SELECT 1
-            FROM reservations res
-            WHERE res.restaurant_id = r.id
-              AND (res.start_time, res.end_time) OVERLAPS (req_start_time, req_end_time)
-        );
+          AND p.plan IS NOT NULL
+          AND (radius_meters IS NULL OR origin IS NULL OR ST_DWithin(r.location, origin, radius_meters))
+        ORDER BY jsonb_array_length(e.matched) DESC, ST_Distance(r.location, origin) NULLS LAST, r.name;
 END;
 $$ LANGUAGE plpgsql;
\ No newline at end of file
@@ -0,0 +1 @@
+DROP FUNCTION IF EXISTS public.test_restaurant_book();
@@ -0,0 +1,2 @@
+DROP FUNCTION IF EXISTS restaurant_alternatives(uuid[], timestamptz, timestamptz, int, jsonb, double precision,
+    double precision, double precision, text, jsonb, interval, interval, int);
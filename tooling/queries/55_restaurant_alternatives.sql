@@ -0,0 +1,53 @@
+-- restaurant_alternatives looks for other start times around a requested one, every step within
+-- search_window either side, and returns the nearest slots_per_restaurant of them at each restaurant
+-- that would suit the party. Each candidate is checked exactly as check_restaurant_availability
+-- would check it, keeping the requested length (or the turn time when no end is given).
+CREATE OR REPLACE FUNCTION restaurant_alternatives(
+    diner_uuids uuid[], req_start_time timestamptz, req_end_time timestamptz,
+    requested_party_size int DEFAULT NULL, guest_preferences jsonb DEFAULT NULL,
+    search_lat double precision DEFAULT NULL, search_lon double precision DEFAULT NULL,
+    radius_meters double precision DEFAULT NULL,
+    match_mode text DEFAULT 'ranked',
+    guest_restrictions jsonb DEFAULT NULL,
+    search_window interval DEFAULT '02:00:00',
+    step interval DEFAULT '00:15:00',
+    slots_per_restaurant int DEFAULT 2
+) RETURNS TABLE(restaurant_id uuid, restaurant_name text, start_time timestamptz, end_time timestamptz, offset_minutes int,
+                matched_endorsements jsonb, missing_endorsements jsonb, seating_plan int[],
+                distance_meters double precision, restaurant_time_zone text) AS $$
+BEGIN
+    IF step <= '0'::interval OR search_window < step THEN
+        RAISE EXCEPTION 'Search step must be positive and no longer than the search window.'
+            USING ERRCODE = 'invalid_parameter_value';
+    END IF;
+
+    IF slots_per_restaurant < 1 THEN
+        RAISE EXCEPTION 'At least one slot per restaurant must be requested.'
+            USING ERRCODE = 'invalid_parameter_value';
+    END IF;
+
+    RETURN QUERY
+        SELECT s.restaurant_id, s.restaurant_name, s.candidate_start, s.candidate_end, s.offset_minutes,
+               s.matched_endorsements, s.missing_endorsements, s.seating_plan, s.distance_meters, s.restaurant_time_zone
+        FROM (
+                 SELECT a.restaurant_id, a.restaurant_name,
+                        c.candidate_start, a.reservation_end_time AS candidate_end,
+                        (extract(epoch FROM c.candidate_start - req_start_time) / 60)::int AS offset_minutes,
+                        a.matched_endorsements, a.missing_endorsements, a.seating_plan, a.distance_meters,
+                        a.restaurant_time_zone,
+                        row_number() OVER (PARTITION BY a.restaurant_id
+                            ORDER BY abs(extract(epoch FROM c.candidate_start - req_start_time)), c.candidate_start) AS nearness
+                 FROM generate_series(req_start_time - search_window, req_start_time + search_window, step) AS c(candidate_start),
+                      LATERAL check_restaurant_availability(
+                              diner_uuids, c.candidate_start, req_end_time + (c.candidate_start - req_start_time),
+                              requested_party_size, guest_preferences, search_lat, search_lon, radius_meters,
+                              match_mode, guest_restrictions) AS a
+                 -- the requested time itself is what the caller already tried, and the past is no use
+                 WHERE c.candidate_start <> req_start_time
+                   AND c.candidate_start > now()
+             ) AS s
+        WHERE s.nearness <= slots_per_restaurant
+        ORDER BY jsonb_array_length(s.matched_endorsements) DESC, s.distance_meters NULLS LAST, s.restaurant_name,
+                 abs(s.offset_minutes), s.offset_minutes;
+END;
+$$ LANGUAGE plpgsql;
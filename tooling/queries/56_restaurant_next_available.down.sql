@@ -0,0 +1 @@
+DROP FUNCTION IF EXISTS restaurant_next_available(uuid, uuid[], timestamptz, timestamptz, int, interval, interval, int);
@@ -0,0 +1,56 @@
+-- Put back select_tops_for_party as 20_restaurant_book created it
+CREATE OR REPLACE FUNCTION public.select_tops_for_party(
+    restaurant_uuid uuid,
+    party_size int,
+    req_start_time timestamp with time zone,
+    req_end_time timestamp with time zone
+) RETURNS uuid[]
+    LANGUAGE plpgsql
+AS $$
+DECLARE
+    total_seating_capacity integer;
+    plan int[];
+    planned RECORD;
+    selected_tables uuid[] := '{}';
+BEGIN
+    -- Calculate the total seating capacity of the restaurant
+    SELECT
+        (cast(capacity->>'two-top' as integer) * 2) +
+        (cast(capacity->>'four-top' as integer) * 4) +
+        (cast(capacity->>'six-top' as integer) * 6)
+    INTO total_seating_capacity
+    FROM public.restaurants
+    WHERE id = restaurant_uuid;
+
+    -- Ensure the party size doesn't exceed the seating capacity
+    IF party_size > total_seating_capacity THEN
+        RAISE EXCEPTION 'Party size exceeds the seating capacity of the restaurant.'
+            USING ERRCODE = 'BD002';
+    END IF;
+
+    -- Work out the best combination of free table sizes for the party
+    plan := public.plan_seating(restaurant_uuid, party_size, req_start_time, req_end_time);
+
+    -- If we don't have enough tables, raise an exception
+    IF plan IS NULL THEN
+        RAISE EXCEPTION 'Not enough available tables to seat the party.'
+            USING ERRCODE = 'BD003';
+    END IF;
+
+    -- Pick that many free tables of each size
+    FOR planned IN
+        SELECT p.table_size, count(*)::int AS wanted
+        FROM unnest(plan) AS p(table_size)
+        GROUP BY p.table_size
+        LOOP
+            selected_tables := selected_tables || ARRAY(
+                SELECT t.table_id
+                FROM public.get_available_tops(restaurant_uuid, req_start_time, req_end_time) t
+                WHERE t.table_size = planned.table_size
+                LIMIT planned.wanted
+            );
+        END LOOP;
+
+    RETURN selected_tables;
+END;
+$$;
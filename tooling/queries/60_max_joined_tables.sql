@@ -0,0 +1,81 @@
+-- select_tops_for_party also refuses parties that could not fit at the largest max_joined_tables tables
+-- even with every table free, with its own message so that callers can tell that apart from a full
+-- restaurant
+CREATE OR REPLACE FUNCTION public.select_tops_for_party(
+    restaurant_uuid uuid,
+    party_size int,
+    req_start_time timestamp with time zone,
+    req_end_time timestamp with time zone
+) RETURNS uuid[]
+    LANGUAGE plpgsql
+AS $$
+DECLARE
+    total_seating_capacity integer;
+    max_tables integer;
+    joinable_seats integer;
+    plan int[];
+    planned RECORD;
+    selected_tables uuid[] := '{}';
+BEGIN
+    -- Calculate the total seating capacity of the restaurant
+    SELECT
+        (cast(capacity->>'two-top' as integer) * 2) +
+        (cast(capacity->>'four-top' as integer) * 4) +
+        (cast(capacity->>'six-top' as integer) * 6)
+    INTO total_seating_capacity
+    FROM public.restaurants
+    WHERE id = restaurant_uuid;
+
+    -- Ensure the party size doesn't exceed the seating capacity
+    IF party_size > total_seating_capacity THEN
+        RAISE EXCEPTION 'Party size exceeds the seating capacity of the restaurant.'
+            USING ERRCODE = 'BD002';
+    END IF;
+
+    -- Even with every table free, the party must fit at the largest max_joined_tables tables
+    SELECT r.max_joined_tables INTO max_tables
+    FROM public.restaurants r
+    WHERE r.id = restaurant_uuid;
+
+    SELECT COALESCE(sum(t.table_size), 0)
+    INTO joinable_seats
+    FROM (
+             SELECT t.table_size
+             FROM public.tops t
+             WHERE t.restaurant_id = restaurant_uuid
+             ORDER BY t.table_size DESC
+             LIMIT max_tables
+         ) AS t;
+
+    IF party_size > joinable_seats THEN
+        RAISE EXCEPTION 'Party of % needs more than the % tables the restaurant will join (max_joined_tables).',
+            party_size, max_tables
+            USING ERRCODE = 'BD002';
+    END IF;
+
+    -- Work out the best combination of free table sizes for the party
+    plan := public.plan_seating(restaurant_uuid, party_size, req_start_time, req_end_time);
+
+    -- If we don't have enough tables, raise an exception
+    IF plan IS NULL THEN
+        RAISE EXCEPTION 'Not enough available tables to seat the party.'
+            USING ERRCODE = 'BD003';
+    END IF;
+
+    -- Pick that many free tables of each size
+    FOR planned IN
+        SELECT p.table_size, count(*)::int AS wanted
+        FROM unnest(plan) AS p(table_size)
+        GROUP BY p.table_size
+        LOOP
+            selected_tables := selected_tables || ARRAY(
+                SELECT t.table_id
+                FROM public.get_available_tops(restaurant_uuid, req_start_time, req_end_time) t
+                WHERE t.table_size = planned.table_size
+                LIMIT planned.wanted
+            );
+        END LOOP;
+
+    RETURN selected_tables;
+END;
+$$;
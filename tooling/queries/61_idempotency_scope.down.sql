@@ -0,0 +1,64 @@
+DROP FUNCTION IF EXISTS public.restaurant_book_idempotent(text, text, text, uuid, uuid[], timestamptz, timestamptz, text, int, jsonb, jsonb);
+
+-- Without scopes a key can only be held once, so where clients picked the same key the earliest
+-- booking keeps it
+DELETE FROM public.idempotency_keys ik
+WHERE EXISTS (
+    SELECT 1
+    FROM public.idempotency_keys earlier
+    WHERE earlier.idempotency_key = ik.idempotency_key
+      AND (earlier.created_at, earlier.scope) < (ik.created_at, ik.scope)
+);
+
+ALTER TABLE public.idempotency_keys DROP CONSTRAINT idempotency_keys_pkey;
+ALTER TABLE public.idempotency_keys DROP COLUMN scope;
+ALTER TABLE public.idempotency_keys ADD PRIMARY KEY (idempotency_key);
+
+-- Put back restaurant_book_idempotent as 24_idempotency created it
+CREATE OR REPLACE FUNCTION public.restaurant_book_idempotent(
+    request_key text,
+    payload_hash text,
+    restaurant_uuid uuid,
+    diner_uuids uuid[],
+    req_start_time timestamp with time zone,
+    req_end_time timestamp with time zone,
+    reservation_notes text DEFAULT NULL,
+    requested_party_size int DEFAULT NULL,
+    guest_preferences jsonb DEFAULT NULL,
+    guest_restrictions jsonb DEFAULT NULL
+) RETURNS TABLE(reservation_id uuid, replayed boolean)
+    LANGUAGE plpgsql
+AS $$
+DECLARE
+    existing RECORD;
+BEGIN
+    -- Serialize concurrent requests carrying the same key
+    PERFORM pg_advisory_xact_lock(hashtext(request_key));
+
+    SELECT ik.request_hash, ik.reservation_id
+    INTO existing
+    FROM public.idempotency_keys ik
+    WHERE ik.idempotency_key = request_key;
+
+    IF FOUND THEN
+        IF existing.request_hash <> payload_hash THEN
+            RAISE EXCEPTION 'Idempotency key % was already used for a different request.', request_key
+                USING ERRCODE = 'BD008';
+        END IF;
+
+        reservation_id := existing.reservation_id;
+        replayed := true;
+        RETURN NEXT;
+        RETURN;
+    END IF;
+
+    reservation_id := public.restaurant_book(restaurant_uuid, diner_uuids, req_start_time, req_end_time, reservation_notes,
+                                             requested_party_size, guest_preferences, guest_restrictions);
+    replayed := false;
+
+    INSERT INTO public.idempotency_keys (idempotency_key, request_hash, reservation_id)
+    VALUES (request_key, payload_hash, restaurant_book_idempotent.reservation_id);
+
+    RETURN NEXT;
+END;
+$$;
@@ -0,0 +1,75 @@
+-- Scope idempotency keys to the client that chose them (a fingerprint of its client ID, or failing
+-- that of the diners booked), so that two clients picking the same key do not collide
+ALTER TABLE public.idempotency_keys ADD COLUMN scope character(64);
+
+-- Keys remembered before scoping belong to the diners booked, which is the scope a retry without a
+-- client ID works out for itself
+UPDATE public.idempotency_keys ik
+SET scope = encode(sha256(convert_to('diners:' || COALESCE((
+    SELECT string_agg(rd.diner_id::text, ',' ORDER BY rd.diner_id::text COLLATE "C")
+    FROM public.reservation_diners rd
+    WHERE rd.reservation_id = ik.reservation_id
+), ''), 'UTF8')), 'hex');
+
+ALTER TABLE public.idempotency_keys ALTER COLUMN scope SET NOT NULL;
+ALTER TABLE public.idempotency_keys DROP CONSTRAINT idempotency_keys_pkey;
+ALTER TABLE public.idempotency_keys ADD PRIMARY KEY (scope, idempotency_key);
+
+DROP FUNCTION public.restaurant_book_idempotent(text, text, uuid, uuid[], timestamptz, timestamptz, text, int, jsonb, jsonb);
+
+-- restaurant_book_idempotent books via restaurant_book unless the key has been seen before in this
+-- scope, in which case it returns the reservation created the first time along with its current
+-- status, which may since have become cancelled. Reusing a key for a different request raises
+-- SQLSTATE BD008. Only successful bookings are remembered, so a failed attempt can be retried.
+CREATE OR REPLACE FUNCTION public.restaurant_book_idempotent(
+    request_scope text,
+    request_key text,
+    payload_hash text,
+    restaurant_uuid uuid,
+    diner_uuids uuid[],
+    req_start_time timestamp with time zone,
+    req_end_time timestamp with time zone,
+    reservation_notes text DEFAULT NULL,
+    requested_party_size int DEFAULT NULL,
+    guest_preferences jsonb DEFAULT NULL,
+    guest_restrictions jsonb DEFAULT NULL
+) RETURNS TABLE(reservation_id uuid, replayed boolean, reservation_status text)
+    LANGUAGE plpgsql
+AS $$
+DECLARE
+    existing RECORD;
+BEGIN
+    -- Serialize concurrent requests carrying the same key
+    PERFORM pg_advisory_xact_lock(hashtext(request_scope || request_key));
+
+    SELECT ik.request_hash, ik.reservation_id, res.status
+    INTO existing
+    FROM public.idempotency_keys ik
+             JOIN public.reservations res ON res.id = ik.reservation_id
+    WHERE ik.scope = request_scope
+      AND ik.idempotency_key = request_key;
+
+    IF FOUND THEN
+        IF existing.request_hash <> payload_hash THEN
+            RAISE EXCEPTION 'Idempotency key % was already used for a different request.', request_key
+                USING ERRCODE = 'BD008';
+        END IF;
+
+        reservation_id := existing.reservation_id;
+        replayed := true;
+        reservation_status := existing.status;
+        RETURN NEXT;
+        RETURN;
+    END IF;
+
+    reservation_id := public.restaurant_book(restaurant_uuid, diner_uuids, req_start_time, req_end_time, reservation_notes,
+                                             requested_party_size, guest_preferences, guest_restrictions);
+    replayed := false;
+    reservation_status := 'confirmed';
+
+    INSERT INTO public.idempotency_keys (scope, idempotency_key, request_hash, reservation_id)
+    VALUES (request_scope, request_key, payload_hash, restaurant_book_idempotent.reservation_id);
+
+    RETURN NEXT;
+END;
+$$;
@@ -0,0 +1,3 @@
+DROP TRIGGER IF EXISTS restaurants_turn_times_within_durations ON public.restaurants;
+DROP TRIGGER IF EXISTS restaurant_turn_times_within_durations ON public.restaurant_turn_times;
+DROP FUNCTION IF EXISTS check_turn_times_within_durations();
@@ -0,0 +1,49 @@
+-- Per-party-size turn times must lie within the restaurant's min_duration and max_duration, as
+-- restaurants.turn_time already must, or every booking that leaves its end to the turn time would be
+-- refused with BD009. A CHECK cannot see the other table, so triggers on both keep to it.
+DO $$
+BEGIN
+    IF EXISTS (
+        SELECT 1
+        FROM restaurant_turn_times tt
+                 JOIN restaurants r ON r.id = tt.restaurant_id
+        WHERE tt.turn_time NOT BETWEEN r.min_duration AND r.max_duration
+    ) THEN
+        RAISE EXCEPTION 'Some turn times are outside their restaurant''s min_duration and max_duration; fix them first.'
+            USING ERRCODE = 'check_violation';
+    END IF;
+END;
+$$;
+
+-- check_turn_times_within_durations is a row trigger raising if any turn time of the restaurant
+-- whose ID is in the column named by its argument falls outside the durations the restaurant accepts
+CREATE OR REPLACE FUNCTION check_turn_times_within_durations()
+    RETURNS trigger AS $$
+DECLARE
+    restaurant_uuid uuid := (to_jsonb(NEW) ->> TG_ARGV[0])::uuid;
+    outlier RECORD;
+BEGIN
+    SELECT tt.turn_time, r.min_duration, r.max_duration
+    INTO outlier
+    FROM restaurant_turn_times tt
+             JOIN restaurants r ON r.id = tt.restaurant_id
+    WHERE tt.restaurant_id = restaurant_uuid
+      AND tt.turn_time NOT BETWEEN r.min_duration AND r.max_duration
+    LIMIT 1;
+
+    IF FOUND THEN
+        RAISE EXCEPTION 'Turn time % is outside the % to % the restaurant accepts.',
+            outlier.turn_time, outlier.min_duration, outlier.max_duration
+            USING ERRCODE = 'check_violation';
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER restaurant_turn_times_within_durations
+    AFTER INSERT OR UPDATE ON public.restaurant_turn_times
+    FOR EACH ROW EXECUTE FUNCTION check_turn_times_within_durations('restaurant_id');
+
+CREATE TRIGGER restaurants_turn_times_within_durations
+    AFTER UPDATE OF min_duration, max_duration ON public.restaurants
+    FOR EACH ROW EXECUTE FUNCTION check_turn_times_within_durations('id');
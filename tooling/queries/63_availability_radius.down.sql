@@ -0,0 +1,80 @@
+-- Put back check_restaurant_availability as 50_restaurant_availability created it
+CREATE OR REPLACE FUNCTION check_restaurant_availability(
+    diner_uuids uuid[], req_start_time timestamptz, req_end_time timestamptz,
+    requested_party_size int DEFAULT NULL, guest_preferences jsonb DEFAULT NULL,
+    search_lat double precision DEFAULT NULL, search_lon double precision DEFAULT NULL,
+    radius_meters double precision DEFAULT NULL,
+    match_mode text DEFAULT 'ranked', -- 'all': every preference must be met too; 'ranked': best matches first
+    guest_restrictions jsonb DEFAULT NULL
+) RETURNS TABLE(restaurant_id uuid, restaurant_name text, matched_endorsements jsonb, message text, seating_plan int[],
+                reservation_end_time timestamptz, distance_meters double precision, missing_endorsements jsonb,
+                restaurant_time_zone text) AS $$
+DECLARE
+    current_restrictions jsonb;
+    current_endorsements jsonb;
+    required_endorsements jsonb;
+    party_size int;
+    origin geography;
+BEGIN
+    -- Step 1: Calculate the party size, counting anonymous guests as well as registered diners
+    party_size := resolve_party_size(diner_uuids, requested_party_size);
+
+    -- Step 2: Get the dietary restrictions and preferences of the diners and guests. Everything the
+    -- party wants is reported as matched or missing, though only preferences can ever be missing.
+    current_restrictions := get_party_restrictions(diner_uuids, guest_restrictions);
+    current_endorsements := get_party_endorsements(diner_uuids, guest_preferences) || current_restrictions;
+    PERFORM validate_endorsements(current_endorsements);
+
+    -- Step 3: Check if any restaurants match the endorsements, counting everything a restaurant's own
+    -- endorsements imply (a vegan kitchen suits vegetarians). Restrictions are always required; in
+    -- ranked mode restaurants are ordered by how many preferences they meet rather than needing all.
+    IF match_mode = 'ranked' THEN
+        required_endorsements := current_restrictions;
+    ELSIF match_mode = 'all' THEN
+        required_endorsements := current_endorsements;
+    ELSE
+        RAISE EXCEPTION 'Unknown match mode %.', match_mode
+            USING ERRCODE = 'invalid_parameter_value';
+    END IF;
+
+    IF NOT EXISTS (
+        SELECT 1
+        FROM restaurants r
+        WHERE expand_endorsements(r.endorsements) @> required_endorsements
+    ) THEN
+        -- Raise an exception if no restaurants match the endorsements
+        RAISE EXCEPTION 'No restaurants match the given endorsements'
+            USING ERRCODE = 'BD004';
+    END IF;
+
+    -- Step 4: Work out where to measure distance from: the given point, or else the middle of the party
+    IF search_lat IS NOT NULL AND search_lon IS NOT NULL THEN
+        origin := ST_SetSRID(ST_MakePoint(search_lon, search_lat), 4326)::geography;
+    ELSE
+        origin := get_party_centroid(diner_uuids);
+    END IF;
+
+    -- Step 5: Proceed with normal availability check if matches are found, only advertising
+    -- restaurants that have a sensible combination of free tables for the party. When no end
+    -- time is given, each restaurant's own turn time for the party decides when it ends.
+    RETURN QUERY
+        SELECT r.id::uuid, r.name::text, e.matched,
+               CASE WHEN jsonb_array_length(e.missing) = 0 THEN 'Full match found' ELSE 'Partial match found' END,
+               p.plan, w.window_end, ST_Distance(r.location, origin), e.missing, r.time_zone
+        FROM restaurants r,
+             LATERAL (SELECT expand_endorsements(r.endorsements) AS offered) x,
+             LATERAL (SELECT endorsements_matched(x.offered, current_endorsements) AS matched,
+                             endorsements_missing(x.offered, current_endorsements) AS missing) e,
+             LATERAL (SELECT COALESCE(req_end_time, req_start_time + reservation_turn_time(r.id, party_size)) AS window_end) w,
+             LATERAL (SELECT plan_seating(r.id, party_size, req_start_time, w.window_end) AS plan) p
+        WHERE x.offered @> required_endorsements
+          AND restaurant_is_open(r.id, req_start_time, w.window_end)
+          AND w.window_end - req_start_time BETWEEN r.min_duration AND r.max_duration
+          AND (cast(r.capacity->>'two-top' as integer) * 2) +
+              (cast(r.capacity->>'four-top' as integer) * 4) +
+              (cast(r.capacity->>'six-top' as integer) * 6) >= party_size
+          AND p.plan IS NOT NULL
+          AND (radius_meters IS NULL OR origin IS NULL OR ST_DWithin(r.location, origin, radius_meters))
+        ORDER BY jsonb_array_length(e.matched) DESC, ST_Distance(r.location, origin) NULLS LAST, r.name;
+END;
+$$ LANGUAGE plpgsql;
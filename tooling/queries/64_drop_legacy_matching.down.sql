@@ -0,0 +1,47 @@
+-- Put back the matching functions as 19_find_available_restaurants and 50_restaurant_availability created them
+CREATE OR REPLACE FUNCTION find_available_restaurants(
+    diner_endorsements jsonb
+)
+    RETURNS TABLE(restaurant_name text) AS $$
+BEGIN
+    RETURN QUERY
+        SELECT r.name
+        FROM restaurants r
+        WHERE
+            -- Check if restaurant endorsements include the diner preferences
+            r.endorsements @> diner_endorsements;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE FUNCTION attempt_match(
+    party_size int, current_endorsements jsonb, req_start_time timestamptz, req_end_time timestamptz
+) RETURNS TABLE(restaurant_name text, matched_endorsements jsonb, message text) AS $$
+BEGIN
+    RETURN QUERY
+        SELECT r.name::text, r.endorsements, 'Full match found'::text
+        FROM restaurants r
+        WHERE r.endorsements @> current_endorsements
+          AND restaurant_is_open(r.id, req_start_time, req_end_time)
+          AND (cast(r.capacity->>'two-top' as integer) * 2) +
+              (cast(r.capacity->>'four-top' as integer) * 4) +
+              (cast(r.capacity->>'six-top' as integer) * 6) >= party_size
+          AND can_seat_party_at_time(r.id, party_size, req_start_time, req_end_time);
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE FUNCTION find_available_restaurants(
+    party_size int, current_endorsements jsonb, req_start_time timestamptz, req_end_time timestamptz
+) RETURNS TABLE(restaurant_name text, matched_endorsements jsonb, message text) AS $$
+BEGIN
+    RETURN QUERY
+        SELECT r.name::text, r.endorsements, 'Full match found'::text
+        FROM restaurants r
+        WHERE
+            (cast(r.capacity->>'two-top' as integer) * 2) +
+            (cast(r.capacity->>'four-top' as integer) * 4) +
+            (cast(r.capacity->>'six-top' as integer) * 6) >= party_size
+          AND r.endorsements @> current_endorsements
+          AND restaurant_is_open(r.id, req_start_time, req_end_time)
+          AND can_seat_party_at_time(r.id, party_size, req_start_time, req_end_time);
+END;
+$$ LANGUAGE plpgsql;
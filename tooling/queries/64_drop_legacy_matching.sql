@@ -0,0 +1,6 @@
+-- attempt_match and both find_available_restaurants predate check_restaurant_availability and still
+-- match on a restaurant's own endorsements, ignoring what they imply, and report all of them as
+-- matched. Nothing calls them any more, so drop them rather than keep two answers to one question.
+DROP FUNCTION find_available_restaurants(int, jsonb, timestamptz, timestamptz);
+DROP FUNCTION attempt_match(int, jsonb, timestamptz, timestamptz);
+DROP FUNCTION find_available_restaurants(jsonb);
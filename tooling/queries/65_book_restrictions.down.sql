@@ -0,0 +1,67 @@
+-- Put back restaurant_book as 20_restaurant_book created it
+CREATE OR REPLACE FUNCTION public.restaurant_book(
+    restaurant_uuid uuid,
+    diner_uuids uuid[],
+    req_start_time timestamp with time zone,
+    req_end_time timestamp with time zone, -- NULL to use the restaurant's turn time for the party
+    reservation_notes text DEFAULT NULL,
+    requested_party_size int DEFAULT NULL, -- NULL when the party is exactly diner_uuids
+    guest_preferences jsonb DEFAULT NULL, -- nice-to-have tags for the anonymous guests, if any
+    guest_restrictions jsonb DEFAULT NULL -- non-negotiable dietary tags for the anonymous guests, if any
+) RETURNS uuid
+    LANGUAGE plpgsql
+AS $$
+DECLARE
+    reservation_uuid uuid;
+    party_size int;
+    selected_tables uuid[];
+BEGIN
+    -- Calculate the party size, counting anonymous guests as well as registered diners
+    party_size := public.resolve_party_size(diner_uuids, requested_party_size);
+
+    IF NOT EXISTS (SELECT 1 FROM public.restaurants r WHERE r.id = restaurant_uuid) THEN
+        RAISE EXCEPTION 'Restaurant % does not exist.', restaurant_uuid
+            USING ERRCODE = 'no_data_found';
+    END IF;
+
+    -- Work out when the reservation ends if the caller left it to us
+    IF req_end_time IS NULL THEN
+        req_end_time := req_start_time + public.reservation_turn_time(restaurant_uuid, party_size);
+    END IF;
+
+    IF NOT public.reservation_duration_allowed(restaurant_uuid, req_start_time, req_end_time) THEN
+        RAISE EXCEPTION 'Reservation duration is outside the range the restaurant accepts.'
+            USING ERRCODE = 'BD009';
+    END IF;
+
+    IF NOT public.restaurant_is_open(restaurant_uuid, req_start_time, req_end_time) THEN
+        RAISE EXCEPTION 'Restaurant is not open for the requested time.'
+            USING ERRCODE = 'BD005';
+    END IF;
+
+    -- Make sure nobody in the party is already booked elsewhere at this time
+    PERFORM public.check_diner_conflicts(diner_uuids, req_start_time, req_end_time, NULL);
+
+    -- Pick tables that can seat the party for the requested window
+    selected_tables := public.select_tops_for_party(restaurant_uuid, party_size, req_start_time, req_end_time);
+
+    -- Insert the new reservation
+    INSERT INTO public.reservations (restaurant_id, start_time, end_time, num_diners, num_guests, guest_restrictions,
+                                     guest_preferences, notes)
+    VALUES (restaurant_uuid, req_start_time, req_end_time, party_size,
+            party_size - COALESCE(array_length(diner_uuids, 1), 0),
+            COALESCE(guest_restrictions, '[]'::jsonb), COALESCE(guest_preferences, '[]'::jsonb), reservation_notes)
+    RETURNING id INTO reservation_uuid;
+
+    -- Insert each diner into the reservation_diners table
+    INSERT INTO public.reservation_diners (reservation_id, diner_id)
+    SELECT reservation_uuid, unnest(diner_uuids);
+
+    -- Assign the selected tables to this reservation for the requested window only
+    INSERT INTO public.reservation_tops (reservation_id, top_id, restaurant_id, start_time, end_time)
+    SELECT reservation_uuid, unnest(selected_tables), restaurant_uuid, req_start_time, req_end_time;
+
+    -- Return the reservation UUID
+    RETURN reservation_uuid;
+END;
+$$;
@@ -0,0 +1,310 @@
+-- Put back the functions as 23_reservation_modify, 63_availability_radius and 65_book_restrictions left them
+CREATE OR REPLACE FUNCTION public.restaurant_book(
+    restaurant_uuid uuid,
+    diner_uuids uuid[],
+    req_start_time timestamp with time zone,
+    req_end_time timestamp with time zone, -- NULL to use the restaurant's turn time for the party
+    reservation_notes text DEFAULT NULL,
+    requested_party_size int DEFAULT NULL, -- NULL when the party is exactly diner_uuids
+    guest_preferences jsonb DEFAULT NULL, -- nice-to-have tags for the anonymous guests, if any
+    guest_restrictions jsonb DEFAULT NULL -- non-negotiable dietary tags for the anonymous guests, if any
+) RETURNS uuid
+    LANGUAGE plpgsql
+AS $$
+DECLARE
+    reservation_uuid uuid;
+    party_size int;
+    selected_tables uuid[];
+BEGIN
+    -- Calculate the party size, counting anonymous guests as well as registered diners
+    party_size := public.resolve_party_size(diner_uuids, requested_party_size);
+
+    IF NOT EXISTS (SELECT 1 FROM public.restaurants r WHERE r.id = restaurant_uuid) THEN
+        RAISE EXCEPTION 'Restaurant % does not exist.', restaurant_uuid
+            USING ERRCODE = 'no_data_found';
+    END IF;
+
+    -- Dietary restrictions are non-negotiable, as in check_restaurant_availability and reservation_modify
+    IF NOT EXISTS (
+        SELECT 1
+        FROM public.restaurants r
+        WHERE r.id = restaurant_uuid
+          AND expand_endorsements(r.endorsements) @> get_party_restrictions(diner_uuids, guest_restrictions)
+    ) THEN
+        RAISE EXCEPTION 'Restaurant does not meet the dietary restrictions of the party.'
+            USING ERRCODE = 'BD004';
+    END IF;
+
+    -- Work out when the reservation ends if the caller left it to us
+    IF req_end_time IS NULL THEN
+        req_end_time := req_start_time + public.reservation_turn_time(restaurant_uuid, party_size);
+    END IF;
+
+    IF NOT public.reservation_duration_allowed(restaurant_uuid, req_start_time, req_end_time) THEN
+        RAISE EXCEPTION 'Reservation duration is outside the range the restaurant accepts.'
+            USING ERRCODE = 'BD009';
+    END IF;
+
+    IF NOT public.restaurant_is_open(restaurant_uuid, req_start_time, req_end_time) THEN
+        RAISE EXCEPTION 'Restaurant is not open for the requested time.'
+            USING ERRCODE = 'BD005';
+    END IF;
+
+    -- Make sure nobody in the party is already booked elsewhere at this time
+    PERFORM public.check_diner_conflicts(diner_uuids, req_start_time, req_end_time, NULL);
+
+    -- Pick tables that can seat the party for the requested window
+    selected_tables := public.select_tops_for_party(restaurant_uuid, party_size, req_start_time, req_end_time);
+
+    -- Insert the new reservation
+    INSERT INTO public.reservations (restaurant_id, start_time, end_time, num_diners, num_guests, guest_restrictions,
+                                     guest_preferences, notes)
+    VALUES (restaurant_uuid, req_start_time, req_end_time, party_size,
+            party_size - COALESCE(array_length(diner_uuids, 1), 0),
+            COALESCE(guest_restrictions, '[]'::jsonb), COALESCE(guest_preferences, '[]'::jsonb), reservation_notes)
+    RETURNING id INTO reservation_uuid;
+
+    -- Insert each diner into the reservation_diners table
+    INSERT INTO public.reservation_diners (reservation_id, diner_id)
+    SELECT reservation_uuid, unnest(diner_uuids);
+
+    -- Assign the selected tables to this reservation for the requested window only
+    INSERT INTO public.reservation_tops (reservation_id, top_id, restaurant_id, start_time, end_time)
+    SELECT reservation_uuid, unnest(selected_tables), restaurant_uuid, req_start_time, req_end_time;
+
+    -- Return the reservation UUID
+    RETURN reservation_uuid;
+END;
+$$;
+
+CREATE OR REPLACE FUNCTION public.reservation_modify(
+    reservation_uuid uuid,
+    new_restaurant_uuid uuid,
+    new_start_time timestamp with time zone,
+    new_end_time timestamp with time zone,
+    add_diner_uuids uuid[],
+    remove_diner_uuids uuid[]
+) RETURNS uuid
+    LANGUAGE plpgsql
+AS $$
+DECLARE
+    current_reservation RECORD;
+    target_restaurant_uuid uuid;
+    target_start_time timestamptz;
+    target_end_time timestamptz;
+    target_diner_uuids uuid[];
+    party_size int;
+    party_restrictions jsonb;
+    selected_tables uuid[];
+BEGIN
+    -- Lock the reservation so that concurrent modifications and cancellations serialize on it
+    SELECT res.id, res.restaurant_id, res.start_time, res.end_time, res.status, res.num_guests, res.guest_restrictions
+    INTO current_reservation
+    FROM public.reservations res
+    WHERE res.id = reservation_uuid
+        FOR UPDATE;
+
+    IF NOT FOUND THEN
+        RAISE EXCEPTION 'Reservation % does not exist.', reservation_uuid
+            USING ERRCODE = 'no_data_found';
+    END IF;
+
+    IF current_reservation.status = 'cancelled' THEN
+        RAISE EXCEPTION 'Reservation % is cancelled and cannot be modified.', reservation_uuid
+            USING ERRCODE = 'object_not_in_prerequisite_state';
+    END IF;
+
+    -- Work out what the reservation should look like afterwards
+    target_restaurant_uuid := COALESCE(new_restaurant_uuid, current_reservation.restaurant_id);
+    target_start_time := COALESCE(new_start_time, current_reservation.start_time);
+    -- Moving the start without saying when to end keeps the reservation's current length
+    target_end_time := COALESCE(new_end_time,
+                                target_start_time + (current_reservation.end_time - current_reservation.start_time));
+
+    IF target_end_time <= target_start_time THEN
+        RAISE EXCEPTION 'Reservation must end after it starts.'
+            USING ERRCODE = 'BD006';
+    END IF;
+
+    SELECT ARRAY(
+        SELECT DISTINCT d
+        FROM (
+                 SELECT rd.diner_id AS d
+                 FROM public.reservation_diners rd
+                 WHERE rd.reservation_id = reservation_uuid
+                 UNION
+                 SELECT unnest(COALESCE(add_diner_uuids, '{}'::uuid[]))
+             ) AS party
+        WHERE d <> ALL(COALESCE(remove_diner_uuids, '{}'::uuid[]))
+    ) INTO target_diner_uuids;
+
+    -- Anonymous guests stay with the reservation whatever happens to the registered diners
+    party_size := COALESCE(array_length(target_diner_uuids, 1), 0) + current_reservation.num_guests;
+    IF party_size = 0 THEN
+        RAISE EXCEPTION 'A reservation must have at least one diner.'
+            USING ERRCODE = 'BD007';
+    END IF;
+
+    -- Re-run the restriction and opening hours checks from check_restaurant_availability. Preferences
+    -- only rank restaurants, so they never stand in the way of a modification.
+    party_restrictions := get_party_restrictions(target_diner_uuids, current_reservation.guest_restrictions);
+    IF NOT EXISTS (
+        SELECT 1
+        FROM public.restaurants r
+        WHERE r.id = target_restaurant_uuid
+    ) THEN
+        RAISE EXCEPTION 'Restaurant % does not exist.', target_restaurant_uuid
+            USING ERRCODE = 'no_data_found';
+    END IF;
+
+    IF NOT EXISTS (
+        SELECT 1
+        FROM public.restaurants r
+        WHERE r.id = target_restaurant_uuid
+          AND expand_endorsements(r.endorsements) @> party_restrictions
+    ) THEN
+        RAISE EXCEPTION 'Restaurant does not meet the dietary restrictions of the party.'
+            USING ERRCODE = 'BD004';
+    END IF;
+
+    IF NOT EXISTS (
+        SELECT 1
+        FROM public.restaurants r
+        WHERE r.id = target_restaurant_uuid
+          AND restaurant_is_open(r.id, target_start_time, target_end_time)
+    ) THEN
+        RAISE EXCEPTION 'Restaurant is not open for the requested time.'
+            USING ERRCODE = 'BD005';
+    END IF;
+
+    IF NOT public.reservation_duration_allowed(target_restaurant_uuid, target_start_time, target_end_time) THEN
+        RAISE EXCEPTION 'Reservation duration is outside the range the restaurant accepts.'
+            USING ERRCODE = 'BD009';
+    END IF;
+
+    -- Make sure nobody in the new party is already booked elsewhere at the new time
+    PERFORM public.check_diner_conflicts(target_diner_uuids, target_start_time, target_end_time, reservation_uuid);
+
+    -- Release our own tables first so the reservation can keep them if they are still free
+    DELETE FROM public.reservation_tops rt WHERE rt.reservation_id = reservation_uuid;
+
+    -- Re-run the capacity check and table selection from restaurant_book
+    selected_tables := public.select_tops_for_party(target_restaurant_uuid, party_size, target_start_time, target_end_time);
+
+    UPDATE public.reservations
+    SET restaurant_id = target_restaurant_uuid,
+        start_time = target_start_time,
+        end_time = target_end_time,
+        num_diners = party_size
+    WHERE id = reservation_uuid;
+
+    DELETE FROM public.reservation_diners rd
+    WHERE rd.reservation_id = reservation_uuid
+      AND rd.diner_id <> ALL(target_diner_uuids);
+
+    INSERT INTO public.reservation_diners (reservation_id, diner_id)
+    SELECT reservation_uuid, unnest(target_diner_uuids)
+    ON CONFLICT DO NOTHING;
+
+    INSERT INTO public.reservation_tops (reservation_id, top_id, restaurant_id, start_time, end_time)
+    SELECT reservation_uuid, unnest(selected_tables), target_restaurant_uuid, target_start_time, target_end_time;
+
+    RETURN reservation_uuid;
+END;
+$$;
+
+CREATE OR REPLACE FUNCTION check_restaurant_availability(
+    diner_uuids uuid[], req_start_time timestamptz, req_end_time timestamptz,
+    requested_party_size int DEFAULT NULL, guest_preferences jsonb DEFAULT NULL,
+    search_lat double precision DEFAULT NULL, search_lon double precision DEFAULT NULL,
+    radius_meters double precision DEFAULT NULL,
+    match_mode text DEFAULT 'ranked', -- 'all': every preference must be met too; 'ranked': best matches first
+    guest_restrictions jsonb DEFAULT NULL
+) RETURNS TABLE(restaurant_id uuid, restaurant_name text, matched_endorsements jsonb, message text, seating_plan int[],
+                reservation_end_time timestamptz, distance_meters double precision, missing_endorsements jsonb,
+                restaurant_time_zone text) AS $$
+DECLARE
+    current_restrictions jsonb;
+    current_endorsements jsonb;
+    required_endorsements jsonb;
+    party_size int;
+    origin geography;
+BEGIN
+    -- Step 1: Calculate the party size, counting anonymous guests as well as registered diners
+    party_size := resolve_party_size(diner_uuids, requested_party_size);
+
+    -- Step 2: Get the dietary restrictions and preferences of the diners and guests. Everything the
+    -- party wants is reported as matched or missing, though only preferences can ever be missing.
+    current_restrictions := get_party_restrictions(diner_uuids, guest_restrictions);
+    current_endorsements := get_party_endorsements(diner_uuids, guest_preferences) || current_restrictions;
+    PERFORM validate_endorsements(current_endorsements);
+
+    -- Step 3: Check if any restaurants match the endorsements, counting everything a restaurant's own
+    -- endorsements imply (a vegan kitchen suits vegetarians). Restrictions are always required; in
+    -- ranked mode restaurants are ordered by how many preferences they meet rather than needing all.
+    IF match_mode = 'ranked' THEN
+        required_endorsements := current_restrictions;
+    ELSIF match_mode = 'all' THEN
+        required_endorsements := current_endorsements;
+    ELSE
+        RAISE EXCEPTION 'Unknown match mode %.', match_mode
+            USING ERRCODE = 'invalid_parameter_value';
+    END IF;
+
+    IF NOT EXISTS (
+        SELECT 1
+        FROM restaurants r
+        WHERE expand_endorsements(r.endorsements) @> required_endorsements
+    ) THEN
+        -- Raise an exception if no restaurants match the endorsements
+        RAISE EXCEPTION 'No restaurants match the given endorsements'
+            USING ERRCODE = 'BD004';
+    END IF;
+
+    -- Step 4: Work out where to measure distance from: the given point, or else the middle of the party
+    IF search_lat IS NOT NULL AND search_lon IS NOT NULL THEN
+        origin := ST_SetSRID(ST_MakePoint(search_lon, search_lat), 4326)::geography;
+    ELSE
+        origin := get_party_centroid(diner_uuids);
+    END IF;
+
+    IF radius_meters IS NOT NULL AND origin IS NULL THEN
+        RAISE EXCEPTION 'A search radius needs a point to search from, and none of the diners has a location.'
+            USING ERRCODE = 'invalid_parameter_value';
+    END IF;
+
+    -- Step 5: Proceed with normal availability check if matches are found, only advertising
+    -- restaurants that have a sensible combination of free tables for the party. When no end
+    -- time is given, each restaurant's own turn time for the party decides when it ends. The radius
+    -- filter is its own branch, rather than an OR, so that it can use the spatial index.
+    RETURN QUERY
+        SELECT r.id::uuid, r.name::text, e.matched,
+               CASE WHEN jsonb_array_length(e.missing) = 0 THEN 'Full match found' ELSE 'Partial match found' END,
+               p.plan, w.window_end, ST_Distance(r.location, origin), e.missing, r.time_zone
+        FROM (
+                 SELECT * FROM restaurants WHERE radius_meters IS NULL
+                 UNION ALL
+                 SELECT * FROM restaurants nearby WHERE ST_DWithin(nearby.location, origin, radius_meters)
+             ) r,
+             LATERAL (SELECT expand_endorsements(r.endorsements) AS offered) x,
+             LATERAL (SELECT endorsements_matched(x.offered, current_endorsements) AS matched,
+                             endorsements_missing(x.offered, current_endorsements) AS missing) e,
+             LATERAL (SELECT COALESCE(req_end_time, req_start_time + reservation_turn_time(r.id, party_size)) AS window_end) w,
+             LATERAL (SELECT plan_seating(r.id, party_size, req_start_time, w.window_end) AS plan) p
+        WHERE x.offered @> required_endorsements
+          AND restaurant_is_open(r.id, req_start_time, w.window_end)
+          AND w.window_end - req_start_time BETWEEN r.min_duration AND r.max_duration
+          AND (cast(r.capacity->>'two-top' as integer) * 2) +
+              (cast(r.capacity->>'four-top' as integer) * 4) +
+              (cast(r.capacity->>'six-top' as integer) * 6) >= party_size
+          AND p.plan IS NOT NULL
+        ORDER BY jsonb_array_length(e.matched) DESC, ST_Distance(r.location, origin) NULLS LAST, r.name;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP INDEX IF EXISTS idx_restaurants_offered_endorsements;
+DROP TRIGGER IF EXISTS endorsement_implications_reexpand ON public.endorsement_implications;
+DROP TRIGGER IF EXISTS restaurants_endorsements_expand ON public.restaurants;
+DROP FUNCTION IF EXISTS reexpand_all_restaurant_endorsements();
+DROP FUNCTION IF EXISTS expand_restaurant_endorsements();
+ALTER TABLE public.restaurants DROP COLUMN IF EXISTS offered_endorsements;
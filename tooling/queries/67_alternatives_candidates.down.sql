@@ -0,0 +1,141 @@
+-- Put back the functions as 55_restaurant_alternatives and 66_offered_endorsements left them
+CREATE OR REPLACE FUNCTION restaurant_alternatives(
+    diner_uuids uuid[], req_start_time timestamptz, req_end_time timestamptz,
+    requested_party_size int DEFAULT NULL, guest_preferences jsonb DEFAULT NULL,
+    search_lat double precision DEFAULT NULL, search_lon double precision DEFAULT NULL,
+    radius_meters double precision DEFAULT NULL,
+    match_mode text DEFAULT 'ranked',
+    guest_restrictions jsonb DEFAULT NULL,
+    search_window interval DEFAULT '02:00:00',
+    step interval DEFAULT '00:15:00',
+    slots_per_restaurant int DEFAULT 2
+) RETURNS TABLE(restaurant_id uuid, restaurant_name text, start_time timestamptz, end_time timestamptz, offset_minutes int,
+                matched_endorsements jsonb, missing_endorsements jsonb, seating_plan int[],
+                distance_meters double precision, restaurant_time_zone text) AS $$
+BEGIN
+    IF step <= '0'::interval OR search_window < step THEN
+        RAISE EXCEPTION 'Search step must be positive and no longer than the search window.'
+            USING ERRCODE = 'invalid_parameter_value';
+    END IF;
+
+    IF slots_per_restaurant < 1 THEN
+        RAISE EXCEPTION 'At least one slot per restaurant must be requested.'
+            USING ERRCODE = 'invalid_parameter_value';
+    END IF;
+
+    RETURN QUERY
+        SELECT s.restaurant_id, s.restaurant_name, s.candidate_start, s.candidate_end, s.offset_minutes,
+               s.matched_endorsements, s.missing_endorsements, s.seating_plan, s.distance_meters, s.restaurant_time_zone
+        FROM (
+                 SELECT a.restaurant_id, a.restaurant_name,
+                        c.candidate_start, a.reservation_end_time AS candidate_end,
+                        (extract(epoch FROM c.candidate_start - req_start_time) / 60)::int AS offset_minutes,
+                        a.matched_endorsements, a.missing_endorsements, a.seating_plan, a.distance_meters,
+                        a.restaurant_time_zone,
+                        row_number() OVER (PARTITION BY a.restaurant_id
+                            ORDER BY abs(extract(epoch FROM c.candidate_start - req_start_time)), c.candidate_start) AS nearness
+                 FROM generate_series(req_start_time - search_window, req_start_time + search_window, step) AS c(candidate_start),
+                      LATERAL check_restaurant_availability(
+                              diner_uuids, c.candidate_start, req_end_time + (c.candidate_start - req_start_time),
+                              requested_party_size, guest_preferences, search_lat, search_lon, radius_meters,
+                              match_mode, guest_restrictions) AS a
+                 -- the requested time itself is what the caller already tried, and the past is no use
+                 WHERE c.candidate_start <> req_start_time
+                   AND c.candidate_start > now()
+             ) AS s
+        WHERE s.nearness <= slots_per_restaurant
+        ORDER BY jsonb_array_length(s.matched_endorsements) DESC, s.distance_meters NULLS LAST, s.restaurant_name,
+                 abs(s.offset_minutes), s.offset_minutes;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE FUNCTION check_restaurant_availability(
+    diner_uuids uuid[], req_start_time timestamptz, req_end_time timestamptz,
+    requested_party_size int DEFAULT NULL, guest_preferences jsonb DEFAULT NULL,
+    search_lat double precision DEFAULT NULL, search_lon double precision DEFAULT NULL,
+    radius_meters double precision DEFAULT NULL,
+    match_mode text DEFAULT 'ranked', -- 'all': every preference must be met too; 'ranked': best matches first
+    guest_restrictions jsonb DEFAULT NULL
+) RETURNS TABLE(restaurant_id uuid, restaurant_name text, matched_endorsements jsonb, message text, seating_plan int[],
+                reservation_end_time timestamptz, distance_meters double precision, missing_endorsements jsonb,
+                restaurant_time_zone text) AS $$
+DECLARE
+    current_restrictions jsonb;
+    current_endorsements jsonb;
+    required_endorsements jsonb;
+    party_size int;
+    origin geography;
+BEGIN
+    -- Step 1: Calculate the party size, counting anonymous guests as well as registered diners
+    party_size := resolve_party_size(diner_uuids, requested_party_size);
+
+    -- Step 2: Get the dietary restrictions and preferences of the diners and guests. Everything the
+    -- party wants is reported as matched or missing, though only preferences can ever be missing.
+    current_restrictions := get_party_restrictions(diner_uuids, guest_restrictions);
+    current_endorsements := get_party_endorsements(diner_uuids, guest_preferences) || current_restrictions;
+    PERFORM validate_endorsements(current_endorsements);
+
+    -- Step 3: Check if any restaurants match the endorsements, counting everything a restaurant's own
+    -- endorsements imply (a vegan kitchen suits vegetarians). Restrictions are always required; in
+    -- ranked mode restaurants are ordered by how many preferences they meet rather than needing all.
+    IF match_mode = 'ranked' THEN
+        required_endorsements := current_restrictions;
+    ELSIF match_mode = 'all' THEN
+        required_endorsements := current_endorsements;
+    ELSE
+        RAISE EXCEPTION 'Unknown match mode %.', match_mode
+            USING ERRCODE = 'invalid_parameter_value';
+    END IF;
+
+    IF NOT EXISTS (
+        SELECT 1
+        FROM restaurants r
+        WHERE r.offered_endorsements @> required_endorsements
+    ) THEN
+        -- Raise an exception if no restaurants match the endorsements
+        RAISE EXCEPTION 'No restaurants match the given endorsements'
+            USING ERRCODE = 'BD004';
+    END IF;
+
+    -- Step 4: Work out where to measure distance from: the given point, or else the middle of the party
+    IF search_lat IS NOT NULL AND search_lon IS NOT NULL THEN
+        origin := ST_SetSRID(ST_MakePoint(search_lon, search_lat), 4326)::geography;
+    ELSE
+        origin := get_party_centroid(diner_uuids);
+    END IF;
+
+    IF radius_meters IS NOT NULL AND origin IS NULL THEN
+        RAISE EXCEPTION 'A search radius needs a point to search from, and none of the diners has a location.'
+            USING ERRCODE = 'invalid_parameter_value';
+    END IF;
+
+    -- Step 5: Proceed with normal availability check if matches are found, only advertising
+    -- restaurants that have a sensible combination of free tables for the party. When no end
+    -- time is given, each restaurant's own turn time for the party decides when it ends. The radius
+    -- filter is its own branch, rather than an OR, so that it can use the spatial index.
+    RETURN QUERY
+        SELECT r.id::uuid, r.name::text, e.matched,
+               CASE WHEN jsonb_array_length(e.missing) = 0 THEN 'Full match found' ELSE 'Partial match found' END,
+               p.plan, w.window_end, ST_Distance(r.location, origin), e.missing, r.time_zone
+        FROM (
+                 SELECT * FROM restaurants WHERE radius_meters IS NULL
+                 UNION ALL
+                 SELECT * FROM restaurants nearby WHERE ST_DWithin(nearby.location, origin, radius_meters)
+             ) r,
+             LATERAL (SELECT endorsements_matched(r.offered_endorsements, current_endorsements) AS matched,
+                             endorsements_missing(r.offered_endorsements, current_endorsements) AS missing) e,
+             LATERAL (SELECT COALESCE(req_end_time, req_start_time + reservation_turn_time(r.id, party_size)) AS window_end) w,
+             LATERAL (SELECT plan_seating(r.id, party_size, req_start_time, w.window_end) AS plan) p
+        WHERE r.offered_endorsements @> required_endorsements
+          AND restaurant_is_open(r.id, req_start_time, w.window_end)
+          AND w.window_end - req_start_time BETWEEN r.min_duration AND r.max_duration
+          AND (cast(r.capacity->>'two-top' as integer) * 2) +
+              (cast(r.capacity->>'four-top' as integer) * 4) +
+              (cast(r.capacity->>'six-top' as integer) * 6) >= party_size
+          AND p.plan IS NOT NULL
+        ORDER BY jsonb_array_length(e.matched) DESC, ST_Distance(r.location, origin) NULLS LAST, r.name;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP FUNCTION IF EXISTS availability_candidates(uuid[], int, jsonb, double precision, double precision, double precision,
+    text, jsonb);
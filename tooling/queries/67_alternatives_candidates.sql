@@ -0,0 +1,200 @@
+-- availability_candidates lists the restaurants that could suit the party at any time: those meeting
+-- its endorsements for the match mode, within the radius and big enough to seat it, along with the
+-- endorsements each matched and missed and how far away it is. Whether a restaurant is open and has
+-- free tables depends on the time, so that is left to the callers.
+CREATE OR REPLACE FUNCTION availability_candidates(
+    diner_uuids uuid[], requested_party_size int DEFAULT NULL, guest_preferences jsonb DEFAULT NULL,
+    search_lat double precision DEFAULT NULL, search_lon double precision DEFAULT NULL,
+    radius_meters double precision DEFAULT NULL,
+    match_mode text DEFAULT 'ranked', -- 'all': every preference must be met too; 'ranked': best matches first
+    guest_restrictions jsonb DEFAULT NULL
+) RETURNS TABLE(restaurant_id uuid, restaurant_name text, matched_endorsements jsonb, missing_endorsements jsonb,
+                distance_meters double precision, restaurant_time_zone text) AS $$
+DECLARE
+    current_restrictions jsonb;
+    current_endorsements jsonb;
+    required_endorsements jsonb;
+    party_size int;
+    origin geography;
+BEGIN
+    -- Step 1: Calculate the party size, counting anonymous guests as well as registered diners
+    party_size := resolve_party_size(diner_uuids, requested_party_size);
+
+    -- Step 2: Get the dietary restrictions and preferences of the diners and guests. Everything the
+    -- party wants is reported as matched or missing, though only preferences can ever be missing.
+    current_restrictions := get_party_restrictions(diner_uuids, guest_restrictions);
+    current_endorsements := get_party_endorsements(diner_uuids, guest_preferences) || current_restrictions;
+    PERFORM validate_endorsements(current_endorsements);
+
+    -- Step 3: Check if any restaurants match the endorsements, counting everything a restaurant's own
+    -- endorsements imply (a vegan kitchen suits vegetarians). Restrictions are always required; in
+    -- ranked mode restaurants are ordered by how many preferences they meet rather than needing all.
+    IF match_mode = 'ranked' THEN
+        required_endorsements := current_restrictions;
+    ELSIF match_mode = 'all' THEN
+        required_endorsements := current_endorsements;
+    ELSE
+        RAISE EXCEPTION 'Unknown match mode %.', match_mode
+            USING ERRCODE = 'invalid_parameter_value';
+    END IF;
+
+    IF NOT EXISTS (
+        SELECT 1
+        FROM restaurants r
+        WHERE r.offered_endorsements @> required_endorsements
+    ) THEN
+        -- Raise an exception if no restaurants match the endorsements
+        RAISE EXCEPTION 'No restaurants match the given endorsements'
+            USING ERRCODE = 'BD004';
+    END IF;
+
+    -- Step 4: Work out where to measure distance from: the given point, or else the middle of the party
+    IF search_lat IS NOT NULL AND search_lon IS NOT NULL THEN
+        origin := ST_SetSRID(ST_MakePoint(search_lon, search_lat), 4326)::geography;
+    ELSE
+        origin := get_party_centroid(diner_uuids);
+    END IF;
+
+    IF radius_meters IS NOT NULL AND origin IS NULL THEN
+        RAISE EXCEPTION 'A search radius needs a point to search from, and none of the diners has a location.'
+            USING ERRCODE = 'invalid_parameter_value';
+    END IF;
+
+    -- Step 5: Keep the restaurants that meet the endorsements and are big enough for the party. The
+    -- radius filter is its own branch, rather than an OR, so that it can use the spatial index.
+    RETURN QUERY
+        SELECT r.id::uuid, r.name::text,
+               endorsements_matched(r.offered_endorsements, current_endorsements),
+               endorsements_missing(r.offered_endorsements, current_endorsements),
+               ST_Distance(r.location, origin), r.time_zone
+        FROM (
+                 SELECT * FROM restaurants WHERE radius_meters IS NULL
+                 UNION ALL
+                 SELECT * FROM restaurants nearby WHERE ST_DWithin(nearby.location, origin, radius_meters)
+             ) r
+        WHERE r.offered_endorsements @> required_endorsements
+          AND (cast(r.capacity->>'two-top' as integer) * 2) +
+              (cast(r.capacity->>'four-top' as integer) * 4) +
+              (cast(r.capacity->>'six-top' as integer) * 6) >= party_size;
+END;
+$$ LANGUAGE plpgsql;
+
+-- check_restaurant_availability checks only the candidate restaurants for opening hours and free tables
+CREATE OR REPLACE FUNCTION check_restaurant_availability(
+    diner_uuids uuid[], req_start_time timestamptz, req_end_time timestamptz,
+    requested_party_size int DEFAULT NULL, guest_preferences jsonb DEFAULT NULL,
+    search_lat double precision DEFAULT NULL, search_lon double precision DEFAULT NULL,
+    radius_meters double precision DEFAULT NULL,
+    match_mode text DEFAULT 'ranked', -- 'all': every preference must be met too; 'ranked': best matches first
+    guest_restrictions jsonb DEFAULT NULL
+) RETURNS TABLE(restaurant_id uuid, restaurant_name text, matched_endorsements jsonb, message text, seating_plan int[],
+                reservation_end_time timestamptz, distance_meters double precision, missing_endorsements jsonb,
+                restaurant_time_zone text) AS $$
+DECLARE
+    party_size int;
+BEGIN
+    party_size := resolve_party_size(diner_uuids, requested_party_size);
+
+    -- Only advertise the candidate restaurants that are open and have a sensible combination of free
+    -- tables for the party. When no end time is given, each restaurant's own turn time for the party
+    -- decides when it ends.
+    RETURN QUERY
+        SELECT c.restaurant_id, c.restaurant_name, c.matched_endorsements,
+               CASE WHEN jsonb_array_length(c.missing_endorsements) = 0 THEN 'Full match found' ELSE 'Partial match found' END,
+               p.plan, w.window_end, c.distance_meters, c.missing_endorsements, c.restaurant_time_zone
+        FROM availability_candidates(diner_uuids, requested_party_size, guest_preferences, search_lat, search_lon,
+                                     radius_meters, match_mode, guest_restrictions) c
+                 JOIN restaurants r ON r.id = c.restaurant_id,
+             LATERAL (SELECT COALESCE(req_end_time, req_start_time + reservation_turn_time(r.id, party_size)) AS window_end) w,
+             LATERAL (SELECT plan_seating(r.id, party_size, req_start_time, w.window_end) AS plan) p
+        WHERE restaurant_is_open(r.id, req_start_time, w.window_end)
+          AND w.window_end - req_start_time BETWEEN r.min_duration AND r.max_duration
+          AND p.plan IS NOT NULL
+        ORDER BY jsonb_array_length(c.matched_endorsements) DESC, c.distance_meters NULLS LAST, c.restaurant_name;
+END;
+$$ LANGUAGE plpgsql;
+
+-- restaurant_alternatives looks for other start times around a requested one, every step within
+-- search_window either side, and returns the nearest slots_per_restaurant of them at each restaurant
+-- that would suit the party, keeping the requested length (or the turn time when no end is given). The
+-- restaurants are narrowed down once with availability_candidates, and each one's opening hours over
+-- the whole search are worked out once too, so that only the times it is open for and would accept
+-- are left for plan_seating to try.
+CREATE OR REPLACE FUNCTION restaurant_alternatives(
+    diner_uuids uuid[], req_start_time timestamptz, req_end_time timestamptz,
+    requested_party_size int DEFAULT NULL, guest_preferences jsonb DEFAULT NULL,
+    search_lat double precision DEFAULT NULL, search_lon double precision DEFAULT NULL,
+    radius_meters double precision DEFAULT NULL,
+    match_mode text DEFAULT 'ranked',
+    guest_restrictions jsonb DEFAULT NULL,
+    search_window interval DEFAULT '02:00:00',
+    step interval DEFAULT '00:15:00',
+    slots_per_restaurant int DEFAULT 2
+) RETURNS TABLE(restaurant_id uuid, restaurant_name text, start_time timestamptz, end_time timestamptz, offset_minutes int,
+                matched_endorsements jsonb, missing_endorsements jsonb, seating_plan int[],
+                distance_meters double precision, restaurant_time_zone text) AS $$
+DECLARE
+    party_size int;
+BEGIN
+    IF step <= '0'::interval OR search_window < step THEN
+        RAISE EXCEPTION 'Search step must be positive and no longer than the search window.'
+            USING ERRCODE = 'invalid_parameter_value';
+    END IF;
+
+    IF slots_per_restaurant < 1 THEN
+        RAISE EXCEPTION 'At least one slot per restaurant must be requested.'
+            USING ERRCODE = 'invalid_parameter_value';
+    END IF;
+
+    party_size := resolve_party_size(diner_uuids, requested_party_size);
+
+    RETURN QUERY
+        WITH candidates AS MATERIALIZED (
+            SELECT c.*, r.min_duration, r.max_duration,
+                   reservation_turn_time(r.id, party_size) AS turn_time,
+                   -- overnight intervals that open the (local) day before the search can still cover it
+                   (SELECT range_agg(tstzrange(i.opens, i.closes))
+                    FROM restaurant_open_intervals(
+                            r.id, ((req_start_time - search_window) AT TIME ZONE r.time_zone)::date - 1,
+                            ((req_start_time + search_window + r.max_duration) AT TIME ZONE r.time_zone)::date) AS i
+                   ) AS open_hours
+            FROM availability_candidates(diner_uuids, requested_party_size, guest_preferences, search_lat, search_lon,
+                                         radius_meters, match_mode, guest_restrictions) c
+                     JOIN restaurants r ON r.id = c.restaurant_id
+        ), slots AS (
+            -- the requested time itself is what the caller already tried, and the past is no use
+            SELECT g.candidate_start
+            FROM generate_series(req_start_time - search_window, req_start_time + search_window, step) AS g(candidate_start)
+            WHERE g.candidate_start <> req_start_time
+              AND g.candidate_start > now()
+        ), windows AS MATERIALIZED (
+            -- the cheap checks, so that plan_seating only looks at times the restaurant is open for
+            -- and would take a reservation of this length
+            SELECT c.restaurant_id, c.restaurant_name, c.matched_endorsements, c.missing_endorsements,
+                   c.distance_meters, c.restaurant_time_zone, sl.candidate_start, w.window_end
+            FROM candidates c
+                     CROSS JOIN slots sl,
+                 LATERAL (SELECT COALESCE(req_end_time + (sl.candidate_start - req_start_time),
+                                          sl.candidate_start + c.turn_time) AS window_end) w
+            WHERE c.open_hours @> tstzrange(sl.candidate_start, w.window_end)
+              AND w.window_end - sl.candidate_start BETWEEN c.min_duration AND c.max_duration
+        )
+        SELECT s.restaurant_id, s.restaurant_name, s.candidate_start, s.candidate_end, s.offset_minutes,
+               s.matched_endorsements, s.missing_endorsements, s.seating_plan, s.distance_meters, s.restaurant_time_zone
+        FROM (
+                 SELECT wi.restaurant_id, wi.restaurant_name,
+                        wi.candidate_start, wi.window_end AS candidate_end,
+                        (extract(epoch FROM wi.candidate_start - req_start_time) / 60)::int AS offset_minutes,
+                        wi.matched_endorsements, wi.missing_endorsements, p.plan AS seating_plan, wi.distance_meters,
+                        wi.restaurant_time_zone,
+                        row_number() OVER (PARTITION BY wi.restaurant_id
+                            ORDER BY abs(extract(epoch FROM wi.candidate_start - req_start_time)), wi.candidate_start) AS nearness
+                 FROM windows wi,
+                      LATERAL (SELECT plan_seating(wi.restaurant_id, party_size, wi.candidate_start, wi.window_end) AS plan) p
+                 WHERE p.plan IS NOT NULL
+             ) AS s
+        WHERE s.nearness <= slots_per_restaurant
+        ORDER BY jsonb_array_length(s.matched_endorsements) DESC, s.distance_meters NULLS LAST, s.restaurant_name,
+                 abs(s.offset_minutes), s.offset_minutes;
+END;
+$$ LANGUAGE plpgsql;
@@ -0,0 +1,88 @@
+DROP FUNCTION IF EXISTS restaurant_next_available(uuid, uuid[], timestamptz, timestamptz, int, interval, interval, int,
+    jsonb, jsonb);
+
+-- Put back restaurant_next_available as 56_restaurant_next_available created it
+CREATE OR REPLACE FUNCTION restaurant_next_available(
+    restaurant_uuid uuid,
+    diner_uuids uuid[],
+    range_start timestamptz,
+    range_end timestamptz,
+    requested_party_size int DEFAULT NULL,
+    slot_length interval DEFAULT NULL,
+    slot_step interval DEFAULT '00:15:00',
+    max_slots int DEFAULT 5
+) RETURNS TABLE(slot_start timestamptz, slot_end timestamptz, seating_plan int[], restaurant_time_zone text) AS $$
+DECLARE
+    party_size int;
+    restaurant RECORD;
+    candidate timestamptz;
+    plan int[];
+    found_slots int := 0;
+BEGIN
+    party_size := resolve_party_size(diner_uuids, requested_party_size);
+
+    SELECT r.time_zone,
+           (cast(r.capacity->>'two-top' as integer) * 2) +
+           (cast(r.capacity->>'four-top' as integer) * 4) +
+           (cast(r.capacity->>'six-top' as integer) * 6) AS total_seats
+    INTO restaurant
+    FROM restaurants r
+    WHERE r.id = restaurant_uuid;
+
+    IF NOT FOUND THEN
+        RAISE EXCEPTION 'Restaurant % does not exist.', restaurant_uuid
+            USING ERRCODE = 'no_data_found';
+    END IF;
+
+    IF range_end < range_start THEN
+        RAISE EXCEPTION 'Search range must end after it starts.'
+            USING ERRCODE = 'BD006';
+    END IF;
+
+    IF slot_step <= '0'::interval OR max_slots < 1 THEN
+        RAISE EXCEPTION 'Slot step and number of slots must be positive.'
+            USING ERRCODE = 'invalid_parameter_value';
+    END IF;
+
+    -- No amount of searching will help a party the restaurant could never seat
+    IF party_size > restaurant.total_seats THEN
+        RAISE EXCEPTION 'Party size exceeds the seating capacity of the restaurant.'
+            USING ERRCODE = 'BD002';
+    END IF;
+
+    slot_length := COALESCE(slot_length, reservation_turn_time(restaurant_uuid, party_size));
+    IF NOT reservation_duration_allowed(restaurant_uuid, range_start, range_start + slot_length) THEN
+        RAISE EXCEPTION 'Reservation duration is outside the range the restaurant accepts.'
+            USING ERRCODE = 'BD009';
+    END IF;
+
+    FOR candidate IN
+        SELECT c FROM generate_series(range_start, range_end, slot_step) AS c
+        LOOP
+            EXIT WHEN found_slots >= max_slots;
+
+            CONTINUE WHEN candidate <= now();
+
+            CONTINUE WHEN NOT restaurant_is_open(restaurant_uuid, candidate, candidate + slot_length);
+
+            CONTINUE WHEN EXISTS (
+                SELECT 1
+                FROM reservation_diners rd
+                         JOIN reservations res ON res.id = rd.reservation_id
+                WHERE rd.diner_id = ANY(diner_uuids)
+                  AND res.status = 'confirmed'
+                  AND (res.start_time, res.end_time) OVERLAPS (candidate, candidate + slot_length)
+            );
+
+            plan := plan_seating(restaurant_uuid, party_size, candidate, candidate + slot_length);
+            CONTINUE WHEN plan IS NULL;
+
+            slot_start := candidate;
+            slot_end := candidate + slot_length;
+            seating_plan := plan;
+            restaurant_time_zone := restaurant.time_zone;
+            found_slots := found_slots + 1;
+            RETURN NEXT;
+        END LOOP;
+END;
+$$ LANGUAGE plpgsql;
@@ -0,0 +1 @@
+ALTER TABLE public.restaurant_hours_exceptions DROP CONSTRAINT IF EXISTS restaurant_hours_exceptions_unique_opening;
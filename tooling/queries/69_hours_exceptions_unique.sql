@@ -0,0 +1,18 @@
+-- A date can have one closed-all-day exception, or intervals opening at different times, but never
+-- the same one twice. Rows repeated exactly say nothing more than one of them, so keep the first;
+-- anything else still clashing has to be sorted out by hand before this will apply.
+DELETE FROM public.restaurant_hours_exceptions e
+WHERE EXISTS (
+    SELECT 1
+    FROM public.restaurant_hours_exceptions earlier
+    WHERE earlier.restaurant_id = e.restaurant_id
+      AND earlier.exception_date = e.exception_date
+      AND earlier.opens_at IS NOT DISTINCT FROM e.opens_at
+      AND earlier.closes_at IS NOT DISTINCT FROM e.closes_at
+      AND earlier.reason IS NOT DISTINCT FROM e.reason
+      AND earlier.ctid < e.ctid
+);
+
+ALTER TABLE public.restaurant_hours_exceptions
+    ADD CONSTRAINT restaurant_hours_exceptions_unique_opening
+        UNIQUE NULLS NOT DISTINCT (restaurant_id, exception_date, opens_at);
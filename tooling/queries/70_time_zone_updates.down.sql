@@ -0,0 +1,31 @@
+DROP FUNCTION IF EXISTS public.restaurant_update(uuid, text, jsonb, text);
+
+-- Put back restaurant_update and is_valid_time_zone as 25_diner_restaurant_writes and 02_restaurants
+-- created them
+CREATE OR REPLACE FUNCTION public.restaurant_update(
+    restaurant_uuid uuid,
+    new_name text,
+    new_endorsements jsonb
+) RETURNS uuid
+    LANGUAGE plpgsql
+AS $$
+BEGIN
+    UPDATE public.restaurants r
+    SET name = COALESCE(new_name, r.name),
+        endorsements = COALESCE(new_endorsements, r.endorsements)
+    WHERE r.id = restaurant_uuid;
+
+    IF NOT FOUND THEN
+        RAISE EXCEPTION 'Restaurant % does not exist.', restaurant_uuid
+            USING ERRCODE = 'no_data_found';
+    END IF;
+
+    RETURN restaurant_uuid;
+END;
+$$;
+
+-- is_valid_time_zone reports whether tz is an IANA time zone name Postgres knows
+CREATE OR REPLACE FUNCTION is_valid_time_zone(tz text)
+    RETURNS boolean AS $$
+SELECT EXISTS (SELECT 1 FROM pg_timezone_names WHERE name = tz);
+$$ LANGUAGE sql STABLE;
@@ -0,0 +1,43 @@
+-- is_valid_time_zone reports whether Postgres recognises tz as a time zone. Converting a time into it
+-- is all it takes to find out, which is far cheaper than scanning pg_timezone_names. It is only STABLE:
+-- the zone database comes with the OS or Postgres and changes when they are upgraded. The CHECK on
+-- restaurants.time_zone therefore only vouches for a zone when the row is written; a zone later
+-- dropped from the database makes the service fall back to UTC for that restaurant's local times.
+CREATE OR REPLACE FUNCTION is_valid_time_zone(tz text)
+    RETURNS boolean AS $$
+BEGIN
+    PERFORM '2000-01-01 00:00:00+00'::timestamptz AT TIME ZONE tz;
+    RETURN true;
+EXCEPTION
+    WHEN invalid_parameter_value THEN
+        RETURN false;
+END;
+$$ LANGUAGE plpgsql STABLE;
+
+DROP FUNCTION public.restaurant_update(uuid, text, jsonb);
+
+-- restaurant_update changes a restaurant's name, endorsements and/or time zone; NULL arguments are left
+-- unchanged
+CREATE OR REPLACE FUNCTION public.restaurant_update(
+    restaurant_uuid uuid,
+    new_name text,
+    new_endorsements jsonb,
+    new_time_zone text DEFAULT NULL
+) RETURNS uuid
+    LANGUAGE plpgsql
+AS $$
+BEGIN
+    UPDATE public.restaurants r
+    SET name = COALESCE(new_name, r.name),
+        endorsements = COALESCE(new_endorsements, r.endorsements),
+        time_zone = COALESCE(new_time_zone, r.time_zone)
+    WHERE r.id = restaurant_uuid;
+
+    IF NOT FOUND THEN
+        RAISE EXCEPTION 'Restaurant % does not exist.', restaurant_uuid
+            USING ERRCODE = 'no_data_found';
+    END IF;
+
+    RETURN restaurant_uuid;
+END;
+$$;
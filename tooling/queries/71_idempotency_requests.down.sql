@@ -0,0 +1,57 @@
+DROP FUNCTION IF EXISTS public.restaurant_book_idempotent(text, text, text, uuid, uuid, uuid[], timestamptz, timestamptz, text, int,
+    jsonb, jsonb);
+ALTER TABLE public.idempotency_keys DROP COLUMN IF EXISTS request_id;
+
+-- Put back restaurant_book_idempotent as 61_idempotency_scope created it
+CREATE OR REPLACE FUNCTION public.restaurant_book_idempotent(
+    request_scope text,
+    request_key text,
+    payload_hash text,
+    restaurant_uuid uuid,
+    diner_uuids uuid[],
+    req_start_time timestamp with time zone,
+    req_end_time timestamp with time zone,
+    reservation_notes text DEFAULT NULL,
+    requested_party_size int DEFAULT NULL,
+    guest_preferences jsonb DEFAULT NULL,
+    guest_restrictions jsonb DEFAULT NULL
+) RETURNS TABLE(reservation_id uuid, replayed boolean, reservation_status text)
+    LANGUAGE plpgsql
+AS $$
+DECLARE
+    existing RECORD;
+BEGIN
+    -- Serialize concurrent requests carrying the same key
+    PERFORM pg_advisory_xact_lock(hashtext(request_scope || request_key));
+
+    SELECT ik.request_hash, ik.reservation_id, res.status
+    INTO existing
+    FROM public.idempotency_keys ik
+             JOIN public.reservations res ON res.id = ik.reservation_id
+    WHERE ik.scope = request_scope
+      AND ik.idempotency_key = request_key;
+
+    IF FOUND THEN
+        IF existing.request_hash <> payload_hash THEN
+            RAISE EXCEPTION 'Idempotency key % was already used for a different request.', request_key
+                USING ERRCODE = 'BD008';
+        END IF;
+
+        reservation_id := existing.reservation_id;
+        replayed := true;
+        reservation_status := existing.status;
+        RETURN NEXT;
+        RETURN;
+    END IF;
+
+    reservation_id := public.restaurant_book(restaurant_uuid, diner_uuids, req_start_time, req_end_time, reservation_notes,
+                                             requested_party_size, guest_preferences, guest_restrictions);
+    replayed := false;
+    reservation_status := 'confirmed';
+
+    INSERT INTO public.idempotency_keys (scope, idempotency_key, request_hash, reservation_id)
+    VALUES (request_scope, request_key, payload_hash, restaurant_book_idempotent.reservation_id);
+
+    RETURN NEXT;
+END;
+$$;
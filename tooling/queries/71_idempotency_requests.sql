@@ -0,0 +1,67 @@
+-- Remember which request made each booking, so that a replay can tell a client retrying an earlier
+-- request from the service retrying its own attempt after losing the connection mid-commit. Keys
+-- remembered before this have no request and always count as replays.
+ALTER TABLE public.idempotency_keys ADD COLUMN request_id uuid;
+
+DROP FUNCTION public.restaurant_book_idempotent(text, text, text, uuid, uuid[], timestamptz, timestamptz, text, int, jsonb, jsonb);
+
+-- restaurant_book_idempotent books via restaurant_book unless the key has been seen before in this
+-- scope, in which case it returns the reservation created the first time along with its current
+-- status, which may since have become cancelled, and whether another request made it. Reusing a key
+-- for a different request raises SQLSTATE BD008. Only successful bookings are remembered, so a failed
+-- attempt can be retried.
+CREATE OR REPLACE FUNCTION public.restaurant_book_idempotent(
+    request_scope text,
+    request_key text,
+    payload_hash text,
+    request_uuid uuid,
+    restaurant_uuid uuid,
+    diner_uuids uuid[],
+    req_start_time timestamp with time zone,
+    req_end_time timestamp with time zone,
+    reservation_notes text DEFAULT NULL,
+    requested_party_size int DEFAULT NULL,
+    guest_preferences jsonb DEFAULT NULL,
+    guest_restrictions jsonb DEFAULT NULL
+) RETURNS TABLE(reservation_id uuid, replayed boolean, reservation_status text)
+    LANGUAGE plpgsql
+AS $$
+DECLARE
+    existing RECORD;
+BEGIN
+    -- Serialize concurrent requests carrying the same key
+    PERFORM pg_advisory_xact_lock(hashtext(request_scope || request_key));
+
+    SELECT ik.request_hash, ik.reservation_id, ik.request_id, res.status
+    INTO existing
+    FROM public.idempotency_keys ik
+             JOIN public.reservations res ON res.id = ik.reservation_id
+    WHERE ik.scope = request_scope
+      AND ik.idempotency_key = request_key;
+
+    IF FOUND THEN
+        IF existing.request_hash <> payload_hash THEN
+            RAISE EXCEPTION 'Idempotency key % was already used for a different request.', request_key
+                USING ERRCODE = 'BD008';
+        END IF;
+
+        reservation_id := existing.reservation_id;
+        -- The same request finding its own booking is the service retrying an attempt whose commit it
+        -- never heard back about, not the client replaying an earlier request
+        replayed := existing.request_id IS DISTINCT FROM request_uuid;
+        reservation_status := existing.status;
+        RETURN NEXT;
+        RETURN;
+    END IF;
+
+    reservation_id := public.restaurant_book(restaurant_uuid, diner_uuids, req_start_time, req_end_time, reservation_notes,
+                                             requested_party_size, guest_preferences, guest_restrictions);
+    replayed := false;
+    reservation_status := 'confirmed';
+
+    INSERT INTO public.idempotency_keys (scope, idempotency_key, request_hash, reservation_id, request_id)
+    VALUES (request_scope, request_key, payload_hash, restaurant_book_idempotent.reservation_id, request_uuid);
+
+    RETURN NEXT;
+END;
+$$;
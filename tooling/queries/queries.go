@@ -0,0 +1,10 @@
+// Package queries embeds the schema migrations and stored procedures so the binaries carry their own
+// SQL. Use core.SQLFS rather than Files directly so an on-disk override directory is honoured.
+package queries
+
+import "embed"
+
+// Files holds every .sql file in this directory
+//
+//go:embed *.sql
+var Files embed.FS
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// stress_book fires many parallel bookings at one restaurant for the same window and then
+// checks that no table ended up assigned to more than one of the resulting reservations.
+
+type Restaurant struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type ReservationTable struct {
+	ID        string `json:"id"`
+	TableSize int    `json:"table_size"`
+}
+
+type Reservation struct {
+	ID     string             `json:"reservation_id"`
+	Tables []ReservationTable `json:"tables"`
+}
+
+// bookingResult is what a single booking attempt came back with
+type bookingResult struct {
+	reservationID string
+	statusCode    int
+	body          string
+	err           error
+}
+
+// getJSON issues a GET and decodes a 200 response into out
+func getJSON(url string, out interface{}) error {
+	resp, err := http.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("error reading response: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status code: %d, response: %s", resp.StatusCode, string(body))
+	}
+	return json.Unmarshal(body, out)
+}
+
+// buildParties asks the service for enough distinct diners to give every worker its own party
+func buildParties(baseURL string, workers, partySize int) ([][]string, error) {
+	var dinerUUIDs []string
+	if err := getJSON(fmt.Sprintf("%s/private/build_party?partySize=%d", baseURL, workers*partySize), &dinerUUIDs); err != nil {
+		return nil, fmt.Errorf("error building party: %v", err)
+	}
+	if len(dinerUUIDs) < workers*partySize {
+		return nil, fmt.Errorf("only %d diners available, need %d", len(dinerUUIDs), workers*partySize)
+	}
+
+	parties := make([][]string, workers)
+	for i := range parties {
+		parties[i] = dinerUUIDs[i*partySize : (i+1)*partySize]
+	}
+	return parties, nil
+}
+
+// postJSON POSTs the given value as a JSON body
+func postJSON(url string, value interface{}) (*http.Response, error) {
+	body, err := json.Marshal(value)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding request: %v", err)
+	}
+	return http.Post(url, "application/json", bytes.NewReader(body))
+}
+
+// pickRestaurant finds a restaurant that can seat the first party during the window
+func pickRestaurant(baseURL string, party []string, startTime, endTime time.Time) (string, error) {
+	resp, err := postJSON(baseURL+"/restaurant/available", map[string]interface{}{
+		"diner_ids":  party,
+		"start_time": startTime.Format(time.RFC3339),
+		"end_time":   endTime.Format(time.RFC3339),
+	})
+	if err != nil {
+		return "", fmt.Errorf("error checking availability: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var restaurants []Restaurant
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("error checking availability: status code %d", resp.StatusCode)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&restaurants); err != nil {
+		return "", fmt.Errorf("error decoding availability: %v", err)
+	}
+	if len(restaurants) == 0 {
+		return "", fmt.Errorf("no restaurant available for the requested window")
+	}
+	logrus.Infof("Hammering %s (%s)", restaurants[0].Name, restaurants[0].ID)
+	return restaurants[0].ID, nil
+}
+
+// book attempts a single booking
+func book(baseURL, restaurantID string, party []string, startTime, endTime time.Time) bookingResult {
+	resp, err := postJSON(baseURL+"/restaurant/book", map[string]interface{}{
+		"restaurant_id": restaurantID,
+		"diner_ids":     party,
+		"start_time":    startTime.Format(time.RFC3339),
+		"end_time":      endTime.Format(time.RFC3339),
+	})
+	if err != nil {
+		return bookingResult{err: err}
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	result := bookingResult{statusCode: resp.StatusCode, body: string(body)}
+	if resp.StatusCode == http.StatusOK {
+		var response map[string]string
+		if err := json.Unmarshal(body, &response); err != nil {
+			result.err = fmt.Errorf("error decoding response: %v", err)
+		} else {
+			result.reservationID = response["reservation_id"]
+		}
+	}
+	return result
+}
+
+func main() {
+	baseURL := flag.String("url", "http://localhost:8080", "Base URL of the web service")
+	workers := flag.Int("workers", 20, "Number of parallel bookings to fire")
+	partySize := flag.Int("party-size", 2, "Number of diners in each booking")
+	restaurantID := flag.String("restaurant", "", "Restaurant to book (default: first available)")
+	startStr := flag.String("start", "", "Reservation start time in RFC3339 (default: 19:00 UTC a week from now)")
+	flag.Parse()
+
+	startTime := time.Now().UTC().AddDate(0, 0, 7).Truncate(24 * time.Hour).Add(19 * time.Hour)
+	if *startStr != "" {
+		var err error
+		if startTime, err = time.Parse(time.RFC3339, *startStr); err != nil {
+			logrus.Fatalf("Invalid start time: %v", err)
+		}
+	}
+	endTime := startTime.Add(2 * time.Hour)
+
+	parties, err := buildParties(*baseURL, *workers, *partySize)
+	if err != nil {
+		logrus.Fatal(err)
+	}
+
+	if *restaurantID == "" {
+		if *restaurantID, err = pickRestaurant(*baseURL, parties[0], startTime, endTime); err != nil {
+			logrus.Fatal(err)
+		}
+	}
+
+	// Release every booking at once so they genuinely race
+	results := make([]bookingResult, *workers)
+	var wg sync.WaitGroup
+	ready := make(chan struct{})
+	for i := 0; i < *workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			<-ready
+			results[i] = book(*baseURL, *restaurantID, parties[i], startTime, endTime)
+		}(i)
+	}
+	close(ready)
+	wg.Wait()
+
+	// Tally outcomes and make sure no table was handed out twice
+	tableOwners := make(map[string]string)
+	booked, rejected, overlaps := 0, 0, 0
+	for _, result := range results {
+		if result.err != nil {
+			logrus.Errorf("Booking failed: %v", result.err)
+			rejected++
+			continue
+		}
+		if result.reservationID == "" {
+			logrus.Infof("Booking rejected with status %d: %s", result.statusCode, strings.TrimSpace(result.body))
+			rejected++
+			continue
+		}
+		booked++
+
+		var reservation Reservation
+		if err := getJSON(fmt.Sprintf("%s/reservation/%s", *baseURL, result.reservationID), &reservation); err != nil {
+			logrus.Fatalf("Error fetching reservation %s: %v", result.reservationID, err)
+		}
+		for _, table := range reservation.Tables {
+			if owner, taken := tableOwners[table.ID]; taken {
+				logrus.Errorf("Table %s assigned to both %s and %s", table.ID, owner, reservation.ID)
+				overlaps++
+				continue
+			}
+			tableOwners[table.ID] = reservation.ID
+		}
+	}
+
+	logrus.Infof("%d bookings succeeded, %d rejected, %d tables in use, %d overlapping assignments",
+		booked, rejected, len(tableOwners), overlaps)
+	if overlaps > 0 {
+		os.Exit(1)
+	}
+}
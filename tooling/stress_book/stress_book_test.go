@@ -0,0 +1,113 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// TestConcurrentBookingsShareNoTable races restaurant_book calls for the only table at a throwaway
+// restaurant and checks that exactly one of them gets it. It needs a migrated database, given by
+// DATABASE_URL, and is skipped without one.
+func TestConcurrentBookingsShareNoTable(t *testing.T) {
+	dsn := os.Getenv("DATABASE_URL")
+	if dsn == "" {
+		t.Skip("DATABASE_URL is not set")
+	}
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatalf("Error opening database: %v", err)
+	}
+	defer db.Close()
+
+	const workers = 16
+
+	// One restaurant, open around the clock, with a single two-top
+	var restaurantID string
+	err = db.QueryRow(`
+		INSERT INTO restaurants (name, capacity, endorsements)
+		VALUES ('stress_book test', '{"two-top": 1, "four-top": 0, "six-top": 0}', '[]')
+		RETURNING id`).Scan(&restaurantID)
+	if err != nil {
+		t.Fatalf("Error creating restaurant: %v", err)
+	}
+	defer func() {
+		if _, err := db.Exec(`DELETE FROM restaurants WHERE id = $1`, restaurantID); err != nil {
+			t.Errorf("Error removing restaurant: %v", err)
+		}
+	}()
+	if _, err := db.Exec(`INSERT INTO tops (restaurant_id, table_size) VALUES ($1, 2)`, restaurantID); err != nil {
+		t.Fatalf("Error adding table: %v", err)
+	}
+	_, err = db.Exec(`
+		INSERT INTO restaurant_hours (restaurant_id, day_of_week, opens_at, closes_at)
+		SELECT $1, d, '00:00', '24:00' FROM generate_series(1, 7) AS d`, restaurantID)
+	if err != nil {
+		t.Fatalf("Error adding opening hours: %v", err)
+	}
+
+	// A diner per worker, so that diner conflicts cannot be what turns the losers away
+	dinerIDs := make([]string, workers)
+	for i := range dinerIDs {
+		err := db.QueryRow(`INSERT INTO diners (name, preferences) VALUES ('stress_book test', '[]') RETURNING id`).
+			Scan(&dinerIDs[i])
+		if err != nil {
+			t.Fatalf("Error creating diner: %v", err)
+		}
+	}
+	defer func() {
+		if _, err := db.Exec(`DELETE FROM diners WHERE id = ANY($1)`, pq.Array(dinerIDs)); err != nil {
+			t.Errorf("Error removing diners: %v", err)
+		}
+	}()
+
+	startTime := time.Now().UTC().AddDate(0, 0, 7).Truncate(time.Hour)
+	endTime := startTime.Add(2 * time.Hour)
+
+	// Release every booking at once so they genuinely race
+	errs := make([]error, workers)
+	var wg sync.WaitGroup
+	ready := make(chan struct{})
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			<-ready
+			var reservationID string
+			errs[i] = db.QueryRow(`SELECT public.restaurant_book($1::uuid, $2::uuid[], $3::timestamptz, $4::timestamptz)`,
+				restaurantID, pq.Array([]string{dinerIDs[i]}), startTime, endTime).Scan(&reservationID)
+		}(i)
+	}
+	close(ready)
+	wg.Wait()
+
+	booked := 0
+	for _, err := range errs {
+		if err == nil {
+			booked++
+			continue
+		}
+		// Losers either see the winner's booking (BD003) or collide with it on the exclusion constraint
+		var pqErr *pq.Error
+		if !errors.As(err, &pqErr) || (pqErr.Code != "BD003" && pqErr.Code != "23P01") {
+			t.Errorf("Unexpected booking error: %v", err)
+		}
+	}
+	if booked != 1 {
+		t.Errorf("%d of %d concurrent bookings succeeded for a single table, want exactly 1", booked, workers)
+	}
+
+	var held int
+	err = db.QueryRow(`SELECT count(*) FROM reservation_tops WHERE restaurant_id = $1`, restaurantID).Scan(&held)
+	if err != nil {
+		t.Fatalf("Error counting table assignments: %v", err)
+	}
+	if held != 1 {
+		t.Errorf("Table assigned %d times, want 1", held)
+	}
+}